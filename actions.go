@@ -0,0 +1,145 @@
+package sigsci
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// applyHeaderActions applies header actions from the agent (response
+// actions, the header of an EndRequest response or the header actions in
+// request actions) to the header in order. Malformed actions are skipped,
+// with an error returned for them.
+func applyHeaderActions(hdr http.Header, actions []schema.Action) error {
+	var errs []error
+	for i, a := range actions {
+		if err := checkHeaderAction(a); err != nil {
+			errs = append(errs, fmt.Errorf("header action %d: %w", i, err))
+			continue
+		}
+		switch a.Code {
+		case schema.AddHdr:
+			hdr.Add(a.Args[0], a.Args[1])
+		case schema.SetHdr:
+			hdr.Set(a.Args[0], a.Args[1])
+		case schema.SetNEHdr:
+			if len(hdr.Get(a.Args[0])) == 0 {
+				hdr.Set(a.Args[0], a.Args[1])
+			}
+		case schema.DelHdr:
+			hdr.Del(a.Args[0])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkHeaderAction returns an error if the header action has an unknown
+// code or too few arguments for the code. Any extra arguments are ignored.
+func checkHeaderAction(a schema.Action) error {
+	var nargs int
+	switch a.Code {
+	case schema.AddHdr, schema.SetHdr, schema.SetNEHdr:
+		nargs = 2
+	case schema.DelHdr:
+		nargs = 1
+	default:
+		return fmt.Errorf("unknown code %d", a.Code)
+	}
+	if len(a.Args) < nargs {
+		return fmt.Errorf("code %d has %d arguments, expected %d", a.Code, len(a.Args), nargs)
+	}
+	if a.Args[0] == "" {
+		return fmt.Errorf("code %d has an empty header name", a.Code)
+	}
+	return nil
+}
+
+// handlerRequest returns the request to pass to the handler, with any
+// request actions from the inspector applied
+func (m *Module) handlerRequest(req *http.Request, out *RPCMsgOut) *http.Request {
+	if len(out.ReqActions) == 0 {
+		return req
+	}
+	hreq, err := applyRequestActions(req, out.ReqActions)
+	if err != nil {
+		log.Printf("ERROR: Received invalid request actions from inspector (skipped): %s", err)
+	}
+	if m.config.Debug() {
+		log.Printf("DEBUG: applied %d request actions: %s %s", len(out.ReqActions), hreq.Method, hreq.URL)
+	}
+	return hreq
+}
+
+// applyRequestActions returns a copy of the request with the request
+// actions from the agent applied in order, so that the request inspected
+// (and reported) is left as is. Malformed actions are skipped, with an
+// error returned for them.
+func applyRequestActions(req *http.Request, actions []schema.Action) (*http.Request, error) {
+	req = req.Clone(req.Context())
+	var errs []error
+	for i, a := range actions {
+		if err := checkRequestAction(a); err != nil {
+			errs = append(errs, fmt.Errorf("request action %d: %w", i, err))
+			continue
+		}
+		switch a.Code {
+		case schema.AddHdr, schema.SetHdr, schema.SetNEHdr, schema.DelHdr:
+			applyHeaderActions(req.Header, actions[i:i+1])
+		case schema.SetQueryParam, schema.DelQueryParam:
+			q := req.URL.Query()
+			if a.Code == schema.SetQueryParam {
+				q.Set(a.Args[0], a.Args[1])
+			} else {
+				q.Del(a.Args[0])
+			}
+			req.URL.RawQuery = q.Encode()
+			req.RequestURI = req.URL.RequestURI()
+		case schema.RewritePath:
+			req.URL.Path = a.Args[0]
+			req.URL.RawPath = ""
+			req.RequestURI = req.URL.RequestURI()
+		case schema.StripBody:
+			req.Body = http.NoBody
+			req.ContentLength = 0
+			req.TransferEncoding = nil
+			req.Header.Del("Content-Length")
+		}
+	}
+	return req, errors.Join(errs...)
+}
+
+// checkRequestAction returns an error if the request action has an unknown
+// code or too few arguments for the code. Any extra arguments are ignored.
+func checkRequestAction(a schema.Action) error {
+	var nargs int
+	switch a.Code {
+	case schema.AddHdr, schema.SetHdr, schema.SetNEHdr, schema.DelHdr:
+		return checkHeaderAction(a)
+	case schema.SetQueryParam:
+		nargs = 2
+	case schema.DelQueryParam, schema.RewritePath:
+		nargs = 1
+	case schema.StripBody:
+		nargs = 0
+	default:
+		return fmt.Errorf("unknown code %d", a.Code)
+	}
+	if len(a.Args) < nargs {
+		return fmt.Errorf("code %d has %d arguments, expected %d", a.Code, len(a.Args), nargs)
+	}
+	switch a.Code {
+	case schema.SetQueryParam, schema.DelQueryParam:
+		if a.Args[0] == "" {
+			return fmt.Errorf("code %d has an empty parameter name", a.Code)
+		}
+	case schema.RewritePath:
+		if !strings.HasPrefix(a.Args[0], "/") {
+			return fmt.Errorf("code %d has a relative path %q", a.Code, a.Args[0])
+		}
+	}
+	return nil
+}
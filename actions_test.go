@@ -0,0 +1,179 @@
+package sigsci
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+func TestApplyHeaderActions(t *testing.T) {
+	hdr := http.Header{
+		"X-Powered-By": []string{"aa"},
+		"X-Report":     []string{"bb"},
+	}
+	actions := []schema.Action{
+		{Code: schema.AddHdr, Args: []string{"csp", "src=abc"}},
+		{Code: schema.AddHdr, Args: []string{"csp"}},
+		{Code: schema.SetHdr, Args: []string{"content-type", "text/json"}},
+		{Code: schema.SetHdr},
+		{Code: schema.SetNEHdr, Args: []string{"x-report", "cc"}},
+		{Code: schema.SetNEHdr, Args: []string{"x-new", "dd"}},
+		{Code: schema.DelHdr, Args: []string{"x-powered-by"}},
+		{Code: schema.DelHdr, Args: []string{""}},
+		{Code: 99, Args: []string{"x-report"}},
+		// Extra arguments are ignored
+		{Code: schema.DelHdr, Args: []string{"x-removed", ""}},
+	}
+	hdr.Set("X-Removed", "ee")
+	err := applyHeaderActions(hdr, actions)
+	if err == nil {
+		t.Errorf("Expected an error for the malformed actions")
+	}
+	expected := http.Header{
+		"Csp":          []string{"src=abc"},
+		"Content-Type": []string{"text/json"},
+		"X-Report":     []string{"bb"},
+		"X-New":        []string{"dd"},
+	}
+	if !reflect.DeepEqual(hdr, expected) {
+		t.Errorf("expected %v, got %v", expected, hdr)
+	}
+
+	if err := applyHeaderActions(hdr, actions[:1]); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+// endRequestInspector ends every request with a response using the
+// header actions
+type endRequestInspector struct {
+	testInspector
+	actions []schema.Action
+}
+
+func (insp *endRequestInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.Type = schema.EndRequest
+	out.StatusCode = 403
+	out.Header = insp.actions
+	out.Body = []byte("denied")
+	return nil
+}
+
+func TestEndRequestHeaderActions(t *testing.T) {
+	insp := &endRequestInspector{actions: []schema.Action{
+		{Code: schema.SetHdr, Args: []string{"Content-Type", "text/plain"}},
+		{Code: schema.SetNEHdr, Args: []string{"Cache-Control", "no-store"}},
+		{Code: schema.SetNEHdr, Args: []string{"Content-Type", "text/html"}},
+		{Code: schema.DelHdr, Args: []string{"X-Powered-By"}},
+	}}
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }),
+		CustomInspector(insp, nil, nil),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Powered-By", "test")
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	expected := http.Header{
+		"Content-Type":  []string{"text/plain"},
+		"Cache-Control": []string{"no-store"},
+	}
+	if w.Code != 403 || w.Body.String() != "denied" || !reflect.DeepEqual(w.Header(), expected) {
+		t.Errorf("Unexpected response %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+}
+
+func TestApplyRequestActions(t *testing.T) {
+	req := httptest.NewRequest("POST", "/admin/../etc?debug=1&id=2", strings.NewReader("payload"))
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("Content-Type", "text/plain")
+	actions := []schema.Action{
+		{Code: schema.DelHdr, Args: []string{"X-Debug"}},
+		{Code: schema.SetHdr, Args: []string{"X-Sanitized", "1"}},
+		{Code: schema.DelQueryParam, Args: []string{"debug"}},
+		{Code: schema.SetQueryParam, Args: []string{"id", "3"}},
+		{Code: schema.RewritePath, Args: []string{"/etc"}},
+		{Code: schema.StripBody},
+		{Code: schema.RewritePath, Args: []string{"relative"}},
+		{Code: schema.SetQueryParam, Args: []string{"id"}},
+		{Code: 99},
+		// Extra arguments are ignored
+		{Code: schema.SetHdr, Args: []string{"X-Extra", "1", "2"}},
+	}
+	hreq, err := applyRequestActions(req, actions)
+	if err == nil {
+		t.Errorf("Expected an error for the malformed actions")
+	}
+	body, _ := io.ReadAll(hreq.Body)
+	if hreq.URL.Path != "/etc" || hreq.URL.RawQuery != "id=3" || hreq.RequestURI != "/etc?id=3" {
+		t.Errorf("Unexpected URL %q (RequestURI %q)", hreq.URL, hreq.RequestURI)
+	}
+	if hreq.Header.Get("X-Debug") != "" || hreq.Header.Get("X-Sanitized") != "1" || hreq.Header.Get("X-Extra") != "1" {
+		t.Errorf("Unexpected header %v", hreq.Header)
+	}
+	if len(body) != 0 || hreq.ContentLength != 0 {
+		t.Errorf("Unexpected body %q (ContentLength %d)", body, hreq.ContentLength)
+	}
+
+	// The original request is left as is
+	if req.URL.Path != "/admin/../etc" || req.URL.RawQuery != "debug=1&id=2" || req.Header.Get("X-Debug") != "1" || req.ContentLength != 7 {
+		t.Errorf("Unexpected change to the original request %q %v", req.URL, req.Header)
+	}
+}
+
+// reqActionsInspector sanitizes every request
+type reqActionsInspector struct {
+	capsInspector
+}
+
+func (insp *reqActionsInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.ReqActions = []schema.Action{
+		{Code: schema.DelQueryParam, Args: []string{"q"}},
+		{Code: schema.StripBody},
+	}
+	return nil
+}
+
+func TestRequestActions(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		insp := &reqActionsInspector{capsInspector{version: schema.ProtocolVersion}}
+		if enabled {
+			insp.caps = []string{schema.CapReqActions}
+		}
+		m, err := NewModule(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				fmt.Fprintf(w, "%s %s", req.URL, body)
+			}),
+			CustomInspector(insp, nil, nil),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create module: %s", err)
+		}
+
+		req := httptest.NewRequest("POST", "/search?q=<script>&page=2", strings.NewReader("q=<script>"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		expected := "/search?q=<script>&page=2 q=<script>"
+		if enabled {
+			expected = "/search?page=2 "
+		}
+		if w.Body.String() != expected {
+			t.Errorf("enabled=%t: unexpected response %q, expected %q", enabled, w.Body.String(), expected)
+		}
+		m.Close()
+	}
+}
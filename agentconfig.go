@@ -0,0 +1,85 @@
+package sigsci
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// agentOverrides are the configuration values from the agent, limited by
+// the module's own configuration. Zero values are not overridden.
+type agentOverrides struct {
+	maxContentLength     int64
+	anomalySize          int64
+	anomalyDuration      time.Duration
+	expectedContentTypes []string
+}
+
+// overrides returns the values from the agent, or nil if none
+func (c *ModuleConfig) overrides() *agentOverrides {
+	o, _ := c.agentOverrides.Load().(*agentOverrides)
+	return o
+}
+
+// applyAgentConfig atomically replaces any configuration from the agent,
+// with the module's own values as the limits. A nil configuration reverts
+// to the module's own configuration.
+func (c *ModuleConfig) applyAgentConfig(ac *schema.AgentConfig) {
+	if ac == nil {
+		c.agentOverrides.Store((*agentOverrides)(nil))
+		return
+	}
+	o := &agentOverrides{
+		maxContentLength: limit(ac.MaxContentLength, c.maxContentLength),
+		anomalySize:      limit(ac.AnomalySize, c.anomalySize),
+		anomalyDuration:  time.Duration(limit(ac.AnomalyDurationMillis, c.anomalyDuration.Milliseconds())) * time.Millisecond,
+	}
+	for _, ct := range ac.ExpectedContentTypes {
+		if ct != "" && c.isAgentContentType(ct) {
+			o.expectedContentTypes = append(o.expectedContentTypes, ct)
+		}
+	}
+	c.agentOverrides.Store(o)
+}
+
+// isAgentContentType returns true if the agent may add the Content-Type
+func (c *ModuleConfig) isAgentContentType(ct string) bool {
+	for _, allowed := range c.agentContentTypes {
+		if strings.EqualFold(ct, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// limit returns the value if positive and within the max, the max if
+// the value exceeds it, or zero (not overridden) if not set
+func limit(v, max int64) int64 {
+	switch {
+	case v <= 0:
+		return 0
+	case v > max:
+		return max
+	}
+	return v
+}
+
+// applyAgentConfig applies the configuration in the agent's reply to
+// ModuleInit, reverting to the module's own configuration if there is
+// none or the agent has not enabled the capability
+func (m *Module) applyAgentConfig(out *RPCMsgOut) {
+	if !m.config.AgentConfig() {
+		return
+	}
+	ac := out.Config
+	if !m.capabilities().has(capModuleConfig) {
+		ac = nil
+	}
+	m.config.applyAgentConfig(ac)
+	if ac != nil && m.config.Debug() {
+		log.Printf("DEBUG: applied agent configuration: MaxContentLength=%d AnomalySize=%d AnomalyDuration=%s ExpectedContentTypes=%q",
+			m.config.MaxContentLength(), m.config.AnomalySize(), m.config.AnomalyDuration(), m.config.ExpectedContentTypes())
+	}
+}
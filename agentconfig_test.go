@@ -0,0 +1,99 @@
+package sigsci
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// configInspector replies to ModuleInit with module configuration
+type configInspector struct {
+	testInspector
+	mu     sync.Mutex
+	caps   []string
+	config *schema.AgentConfig
+}
+
+func (insp *configInspector) set(caps []string, config *schema.AgentConfig) {
+	insp.mu.Lock()
+	insp.caps, insp.config = caps, config
+	insp.mu.Unlock()
+}
+
+func (insp *configInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	out.WAFResponse = 200
+	out.ProtocolVersion = schema.ProtocolVersion
+	out.Capabilities = insp.caps
+	out.Config = insp.config
+	return nil
+}
+
+func TestAgentConfig(t *testing.T) {
+	insp := &configInspector{}
+	insp.set([]string{schema.CapModuleConfig}, &schema.AgentConfig{
+		MaxContentLength:      200000, // exceeds the module's limit
+		AnomalySize:           1024,
+		AnomalyDurationMillis: 50,
+		ExpectedContentTypes:  []string{"application/x-custom", "text/plain"}, // text/plain is not allowed
+	})
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		CustomInspector(insp, nil, nil),
+		MaxContentLength(100000),
+		ExpectedContentType("text/csv"),
+		AgentContentTypes("application/x-custom"),
+		HealthCheck(5*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	c := m.ModuleConfig()
+	if c.MaxContentLength() != 100000 || c.AnomalySize() != 1024 || c.AnomalyDuration() != 50*time.Millisecond {
+		t.Errorf("Unexpected config: MaxContentLength=%d AnomalySize=%d AnomalyDuration=%s", c.MaxContentLength(), c.AnomalySize(), c.AnomalyDuration())
+	}
+	if types := c.ExpectedContentTypes(); !reflect.DeepEqual(types, []string{"text/csv", "application/x-custom"}) {
+		t.Errorf("Unexpected content types %q", types)
+	}
+	if !c.IsExpectedContentType("application/x-custom; charset=utf-8") || !c.IsExpectedContentType("text/csv") {
+		t.Errorf("Expected content types not matched")
+	}
+
+	// The health check refreshes the configuration, reverting to the
+	// module's own configuration once the agent stops sending it
+	insp.set([]string{schema.CapModuleConfig}, &schema.AgentConfig{MaxContentLength: 500})
+	waitFor(t, func() bool { return c.MaxContentLength() == 500 })
+	if c.AnomalySize() != DefaultAnomalySize || c.IsExpectedContentType("application/x-custom") {
+		t.Errorf("Unexpected config: AnomalySize=%d ExpectedContentTypes=%q", c.AnomalySize(), c.ExpectedContentTypes())
+	}
+	insp.set(nil, &schema.AgentConfig{MaxContentLength: 500})
+	waitFor(t, func() bool { return c.MaxContentLength() == 100000 })
+}
+
+func TestAgentConfigDisabled(t *testing.T) {
+	insp := &configInspector{}
+	insp.set([]string{schema.CapModuleConfig}, &schema.AgentConfig{MaxContentLength: 10})
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		CustomInspector(insp, nil, nil),
+		AgentConfig(false),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	if n := m.ModuleConfig().MaxContentLength(); n != DefaultMaxContentLength {
+		t.Errorf("Unexpected MaxContentLength %d", n)
+	}
+	if caps := m.AgentCapabilities(); len(caps) != 0 {
+		t.Errorf("Unexpected capabilities %q", caps)
+	}
+}
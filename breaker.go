@@ -0,0 +1,199 @@
+package sigsci
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned instead of calling the inspector while the
+// circuit breaker is open
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker around the inspector
+type BreakerState int
+
+const (
+	// BreakerClosed is the normal state where the inspector is called
+	BreakerClosed BreakerState = iota
+	// BreakerOpen is the state where the inspector is not called and
+	// the module fails open immediately
+	BreakerOpen
+	// BreakerHalfOpen is the state where probe calls are made to the
+	// inspector to decide if the breaker should be closed again
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// circuitBreaker tracks inspector failures so that calls can be skipped
+// while the inspector (agent) is unavailable
+type circuitBreaker struct {
+	failureThreshold int           // consecutive failures to open, zero to disable
+	errorRate        float64       // error rate over the window to open, zero to disable
+	window           []bool        // ring of recent results, true on error
+	cooldown         time.Duration // time to stay open before probing
+	probes           int           // successful probes needed to close
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int // consecutive failures
+	pos       int // next position in the window
+	count     int // results in the window
+	nerrors   int // errors in the window
+	openedAt  time.Time
+	probing   bool // a probe call is in flight
+	successes int  // successful probes
+}
+
+func newCircuitBreaker(failures int, errorRate float64, window int, cooldown time.Duration, probes int) *circuitBreaker {
+	if probes < 1 {
+		probes = 1
+	}
+	return &circuitBreaker{
+		failureThreshold: failures,
+		errorRate:        errorRate,
+		window:           make([]bool, window),
+		cooldown:         cooldown,
+		probes:           probes,
+	}
+}
+
+// do calls fn if the breaker allows it and records the result. Calls
+// abandoned because the caller's context is done are not recorded. A nil
+// breaker always calls fn.
+func (cb *circuitBreaker) do(fn func() error) error {
+	if cb == nil {
+		return fn()
+	}
+	if !cb.allow() {
+		return ErrBreakerOpen
+	}
+	err := fn()
+	if isContextError(err) {
+		cb.abandon()
+	} else {
+		cb.record(err)
+	}
+	return err
+}
+
+// State returns the current breaker state
+func (cb *circuitBreaker) State() BreakerState {
+	if cb == nil {
+		return BreakerClosed
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == BreakerOpen && time.Since(cb.openedAt) >= cb.cooldown {
+		return BreakerHalfOpen
+	}
+	return cb.state
+}
+
+// allow returns true if a call should be made, allowing a single probe
+// call at a time once the open breaker has cooled down
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case BreakerOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = BreakerHalfOpen
+		cb.successes = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+	}
+	return true
+}
+
+// record records the result of an allowed call
+func (cb *circuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		// a call allowed before the breaker opened
+		return
+	case BreakerHalfOpen:
+		cb.probing = false
+		if err != nil {
+			cb.openLocked()
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.probes {
+			cb.resetLocked()
+		}
+		return
+	}
+
+	if err != nil {
+		cb.failures++
+	} else {
+		cb.failures = 0
+	}
+	if len(cb.window) > 0 {
+		if cb.count == len(cb.window) {
+			if cb.window[cb.pos] {
+				cb.nerrors--
+			}
+		} else {
+			cb.count++
+		}
+		cb.window[cb.pos] = err != nil
+		if err != nil {
+			cb.nerrors++
+		}
+		cb.pos = (cb.pos + 1) % len(cb.window)
+	}
+
+	switch {
+	case cb.failureThreshold > 0 && cb.failures >= cb.failureThreshold:
+		cb.openLocked()
+	case cb.errorRate > 0 && cb.count == len(cb.window) && float64(cb.nerrors)/float64(cb.count) >= cb.errorRate:
+		cb.openLocked()
+	}
+}
+
+// abandon releases an allowed call without recording a result
+func (cb *circuitBreaker) abandon() {
+	cb.mu.Lock()
+	if cb.state == BreakerHalfOpen {
+		cb.probing = false
+	}
+	cb.mu.Unlock()
+}
+
+func (cb *circuitBreaker) openLocked() {
+	cb.state = BreakerOpen
+	cb.openedAt = time.Now()
+}
+
+func (cb *circuitBreaker) resetLocked() {
+	cb.state = BreakerClosed
+	cb.failures = 0
+	cb.pos = 0
+	cb.count = 0
+	cb.nerrors = 0
+	for i := range cb.window {
+		cb.window[i] = false
+	}
+}
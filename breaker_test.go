@@ -0,0 +1,163 @@
+package sigsci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errTestFailure = errors.New("test failure")
+
+func TestCircuitBreakerFailures(t *testing.T) {
+	cb := newCircuitBreaker(3, 0, 0, 20*time.Millisecond, 2)
+
+	for i := 0; i < 3; i++ {
+		if cb.State() != BreakerClosed {
+			t.Fatalf("call %d: unexpected state %s", i, cb.State())
+		}
+		if err := cb.do(func() error { return errTestFailure }); err != errTestFailure {
+			t.Fatalf("call %d: unexpected error: %v", i, err)
+		}
+	}
+	if cb.State() != BreakerOpen {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerOpen)
+	}
+	if err := cb.do(func() error { return nil }); err != ErrBreakerOpen {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A failed probe opens the breaker again
+	time.Sleep(30 * time.Millisecond)
+	if cb.State() != BreakerHalfOpen {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerHalfOpen)
+	}
+	cb.do(func() error { return errTestFailure })
+	if cb.State() != BreakerOpen {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerOpen)
+	}
+
+	// Successful probes close the breaker
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := cb.do(func() error { return nil }); err != nil {
+			t.Fatalf("probe %d: unexpected error: %v", i, err)
+		}
+	}
+	if cb.State() != BreakerClosed {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerClosed)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	cb := newCircuitBreaker(1, 0, 0, 0, 1)
+	cb.do(func() error { return errTestFailure })
+
+	// Only one probe call is allowed at a time
+	if !cb.allow() {
+		t.Fatalf("Expected a probe call to be allowed")
+	}
+	if cb.allow() {
+		t.Fatalf("Expected a second probe call to be rejected")
+	}
+	cb.record(nil)
+	if cb.State() != BreakerClosed {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerClosed)
+	}
+}
+
+func TestCircuitBreakerAbandoned(t *testing.T) {
+	cb := newCircuitBreaker(1, 0, 0, 0, 1)
+
+	// Calls abandoned by the caller are not failures
+	cb.do(func() error { return context.Canceled })
+	if cb.State() != BreakerClosed {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerClosed)
+	}
+
+	// An abandoned probe allows another probe
+	cb.do(func() error { return errTestFailure })
+	cb.do(func() error { return fmt.Errorf("call failed: %w", context.DeadlineExceeded) })
+	if cb.State() != BreakerHalfOpen {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerHalfOpen)
+	}
+	if !cb.allow() {
+		t.Fatalf("Expected a probe call to be allowed")
+	}
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	cb := newCircuitBreaker(0, 0.5, 4, time.Minute, 1)
+
+	results := []error{errTestFailure, nil, nil, nil, errTestFailure, nil, nil}
+	for i, result := range results {
+		cb.do(func() error { return result })
+		if cb.State() != BreakerClosed {
+			t.Fatalf("call %d: unexpected state %s", i, cb.State())
+		}
+	}
+	cb.do(func() error { return errTestFailure })
+	if cb.State() != BreakerOpen {
+		t.Fatalf("Unexpected state %s, expected %s", cb.State(), BreakerOpen)
+	}
+}
+
+// failingInspector is an inspector where all calls fail
+type failingInspector struct {
+	calls int32
+}
+
+func (insp *failingInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
+	atomic.AddInt32(&insp.calls, 1)
+	return errTestFailure
+}
+
+func (insp *failingInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	atomic.AddInt32(&insp.calls, 1)
+	return errTestFailure
+}
+
+func (insp *failingInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	atomic.AddInt32(&insp.calls, 1)
+	return errTestFailure
+}
+
+func (insp *failingInspector) UpdateRequest(in *RPCMsgIn2, out *RPCMsgOut) error {
+	atomic.AddInt32(&insp.calls, 1)
+	return errTestFailure
+}
+
+func TestModuleCircuitBreaker(t *testing.T) {
+	insp := &failingInspector{}
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			status := http.StatusOK
+			http.Error(w, fmt.Sprintf("%d %s\n", status, http.StatusText(status)), status)
+		}),
+		CustomInspector(insp, nil, nil),
+		CircuitBreaker(3, time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("request %d: unexpected status code=%d", i, w.Code)
+		}
+	}
+
+	// ModuleInit plus two PreRequest calls before the breaker opened
+	if n := atomic.LoadInt32(&insp.calls); n != 3 {
+		t.Errorf("Unexpected number of inspector calls=%d, expected=3", n)
+	}
+	if m.BreakerState() != BreakerOpen {
+		t.Errorf("Unexpected breaker state %s, expected %s", m.BreakerState(), BreakerOpen)
+	}
+}
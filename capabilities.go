@@ -0,0 +1,152 @@
+package sigsci
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// capabilities is a set of features negotiated with the agent
+type capabilities uint32
+
+const (
+	capEndRequest capabilities = 1 << iota
+	capRespActions
+	capBatchRequest
+	capModuleConfig
+	capReportResponse
+	capTarpit
+	capDropConnection
+	capSlowResponse
+	capReqActions
+)
+
+// capabilityNames maps the capabilities supported by the module to their
+// names in the schema, in the order they are advertised
+var capabilityNames = []struct {
+	cap  capabilities
+	name string
+}{
+	{capEndRequest, schema.CapEndRequest},
+	{capRespActions, schema.CapRespActions},
+	{capBatchRequest, schema.CapBatchRequest},
+	{capModuleConfig, schema.CapModuleConfig},
+	{capReportResponse, schema.CapReportResponse},
+	{capTarpit, schema.CapTarpit},
+	{capDropConnection, schema.CapDropConnection},
+	{capSlowResponse, schema.CapSlowResponse},
+	{capReqActions, schema.CapReqActions},
+}
+
+// legacyCapabilities are used with an agent that predates the capability
+// exchange, and until the exchange is made, which are the features used
+// before the exchange existed. Batches are still only sent if supported
+// by the agent, as the RPCInspector falls back to individual reports.
+const legacyCapabilities = capEndRequest | capRespActions | capBatchRequest
+
+// supported returns the capabilities supported by the module
+func (m *Module) supported() capabilities {
+	caps := capEndRequest | capRespActions | capBatchRequest | capReportResponse |
+		capTarpit | capDropConnection | capSlowResponse | capReqActions
+	if m.config.AgentConfig() {
+		caps |= capModuleConfig
+	}
+	return caps
+}
+
+// parseCapabilities returns the capabilities for the names, ignoring any
+// names not supported by the module
+func parseCapabilities(names []string) capabilities {
+	var caps capabilities
+	for _, name := range names {
+		for _, c := range capabilityNames {
+			if c.name == name {
+				caps |= c.cap
+			}
+		}
+	}
+	return caps
+}
+
+// has returns true if all of the given capabilities are in the set
+func (c capabilities) has(caps capabilities) bool {
+	return c&caps == caps
+}
+
+// names returns the names of the capabilities in the set
+func (c capabilities) names() []string {
+	var names []string
+	for _, n := range capabilityNames {
+		if c.has(n.cap) {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+// negotiate enables the capabilities from the agent's reply to ModuleInit
+func (m *Module) negotiate(out *RPCMsgOut) {
+	caps := legacyCapabilities
+	if out.ProtocolVersion > 0 {
+		caps = parseCapabilities(out.Capabilities) & m.supported()
+	}
+	if old := capabilities(atomic.SwapUint32(&m.caps, uint32(caps))); old != caps && m.config.Debug() {
+		log.Printf("DEBUG: agent capabilities (protocol version %d): %v", out.ProtocolVersion, caps.names())
+	}
+	m.applyAgentConfig(out)
+}
+
+// capabilities returns the capabilities enabled by the agent
+func (m *Module) capabilities() capabilities {
+	return capabilities(atomic.LoadUint32(&m.caps))
+}
+
+// AgentCapabilities returns the names of the capabilities (e.g.,
+// schema.CapEndRequest) enabled by the agent in reply to ModuleInit. For
+// an agent that predates the capability exchange, these are the features
+// used before the exchange existed.
+func (m *Module) AgentCapabilities() []string {
+	return m.capabilities().names()
+}
+
+// applyCapabilities ignores the parts of a PreRequest reply that use
+// capabilities not enabled by the agent
+func (m *Module) applyCapabilities(out *RPCMsgOut) {
+	caps := m.capabilities()
+	if c := responseTypeCapability(out.Type); c != 0 && !caps.has(c) {
+		dropResponseType(out)
+	}
+	if !caps.has(capRespActions) {
+		out.RespActions = nil
+	}
+	if !caps.has(capReqActions) {
+		out.ReqActions = nil
+	}
+}
+
+// dropResponseType removes the response type from a PreRequest reply, so
+// that the WAFResponse is used instead
+func dropResponseType(out *RPCMsgOut) {
+	out.Type = 0
+	out.StatusCode = 0
+	out.Header = nil
+	out.Body = nil
+	out.DelayMillis = 0
+}
+
+// responseTypeCapability returns the capability needed for a response
+// type, or none for unknown types (which are rejected as invalid)
+func responseTypeCapability(typ int) capabilities {
+	switch typ {
+	case schema.EndRequest:
+		return capEndRequest
+	case schema.Tarpit:
+		return capTarpit
+	case schema.DropConnection:
+		return capDropConnection
+	case schema.SlowResponse:
+		return capSlowResponse
+	}
+	return 0
+}
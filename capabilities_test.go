@@ -0,0 +1,157 @@
+package sigsci
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// capsInspector replies to ModuleInit with capabilities and to
+// PreRequest with an EndRequest response and response actions
+type capsInspector struct {
+	testInspector
+	version int32
+	caps    []string
+	init    RPCMsgIn
+}
+
+func (insp *capsInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
+	insp.init = *in
+	out.WAFResponse = 200
+	out.ProtocolVersion = insp.version
+	out.Capabilities = insp.caps
+	return nil
+}
+
+func (insp *capsInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.RespActions = []schema.Action{{Code: schema.AddHdr, Args: []string{"X-Resp", "1"}}}
+	if in.URI == "/end" {
+		out.Type = schema.EndRequest
+		out.StatusCode = 418
+	}
+	return nil
+}
+
+func TestCapabilities(t *testing.T) {
+	cases := []struct {
+		version  int32
+		caps     []string
+		expected []string
+		status   int    // of an EndRequest response
+		header   string // added by the response actions
+	}{
+		// An agent predating the exchange
+		{0, nil, []string{schema.CapEndRequest, schema.CapRespActions, schema.CapBatchRequest}, 418, "1"},
+		{1, []string{schema.CapEndRequest, schema.CapRespActions, schema.CapBatchRequest, "Unknown"}, []string{schema.CapEndRequest, schema.CapRespActions, schema.CapBatchRequest}, 418, "1"},
+		{1, []string{schema.CapRespActions}, []string{schema.CapRespActions}, 200, "1"},
+		{1, nil, nil, 200, ""},
+	}
+
+	for pos, tt := range cases {
+		insp := &capsInspector{version: tt.version, caps: tt.caps}
+		m, err := NewModule(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }),
+			CustomInspector(insp, nil, nil),
+		)
+		if err != nil {
+			t.Fatalf("test %d: failed to create module: %s", pos, err)
+		}
+		if insp.init.ProtocolVersion != schema.ProtocolVersion || !reflect.DeepEqual(insp.init.Capabilities, m.supported().names()) {
+			t.Errorf("test %d: unexpected ModuleInit capabilities %d %q", pos, insp.init.ProtocolVersion, insp.init.Capabilities)
+		}
+		if caps := m.AgentCapabilities(); !reflect.DeepEqual(caps, tt.expected) {
+			t.Errorf("test %d: unexpected capabilities %q, expected %q", pos, caps, tt.expected)
+		}
+
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/end", nil))
+		if w.Code != tt.status {
+			t.Errorf("test %d: unexpected status %d, expected %d", pos, w.Code, tt.status)
+		}
+		w = httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if hv := w.Header().Get("X-Resp"); hv != tt.header {
+			t.Errorf("test %d: unexpected response header %q, expected %q", pos, hv, tt.header)
+		}
+		m.Close()
+	}
+}
+
+// reportInspector blocks "/post" and replies to reports with tags
+type reportInspector struct {
+	capsInspector
+}
+
+func (insp *reportInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	switch in.URI {
+	case "/post":
+		out.WAFResponse = 406
+	case "/update":
+		out.RequestID = "0123456789abcdef01234567"
+	}
+	return nil
+}
+
+func (insp *reportInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.RequestHeaders = [][2]string{{"X-Sigsci-Tags", "POST"}}
+	return nil
+}
+
+func (insp *reportInspector) UpdateRequest(in *RPCMsgIn2, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.RequestHeaders = [][2]string{{"X-Sigsci-Tags", "UPDATE"}}
+	return nil
+}
+
+func TestReportResponse(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		insp := &reportInspector{capsInspector{version: schema.ProtocolVersion}}
+		if enabled {
+			insp.caps = []string{schema.CapReportResponse}
+		}
+		responses := make(chan string, 2)
+		m, err := NewModule(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }),
+			CustomInspector(insp, nil, nil),
+			ReportResponseHandler(func(in *RPCMsgIn, in2 *RPCMsgIn2, out *RPCMsgOut) {
+				switch {
+				case in != nil:
+					responses <- in.URI + " " + out.RequestHeaders[0][1]
+				case in2 != nil:
+					responses <- in2.RequestID + " " + out.RequestHeaders[0][1]
+				}
+			}),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create module: %s", err)
+		}
+		for _, uri := range []string{"/post", "/update"} {
+			m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", uri, nil))
+		}
+		if err := m.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Failed to shut down module: %s", err)
+		}
+		close(responses)
+
+		var got []string
+		for r := range responses {
+			got = append(got, r)
+		}
+		sort.Strings(got)
+		var expected []string
+		if enabled {
+			expected = []string{"/post POST", "0123456789abcdef01234567 UPDATE"}
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("enabled=%t: unexpected report responses %q, expected %q", enabled, got, expected)
+		}
+	}
+}
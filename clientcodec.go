@@ -5,6 +5,8 @@ import (
 	"io"
 	"net"
 	"net/rpc"
+	"sync"
+	"time"
 
 	"github.com/tinylib/msgp/msgp"
 )
@@ -15,27 +17,79 @@ import (
 // * https://golang.org/pkg/net/rpc/
 //
 
+// The buffered readers and writers are reused across connections, as a
+// connection may only be used for a single call
+var (
+	msgpReaderPool = sync.Pool{New: func() interface{} { return msgp.NewReader(nil) }}
+	msgpWriterPool = sync.Pool{New: func() interface{} { return msgp.NewWriter(nil) }}
+)
+
 // defines the MSGPACK RPC format
 type msgpClientCodec struct {
-	dec *msgp.Reader
-	enc *msgp.Writer
+	dec *msgp.Reader // only used by the rpc.Client reading goroutine
 	c   io.Closer
+
+	mu  sync.Mutex
+	enc *msgp.Writer // nil once closed
+
+	// conn and writeTimeout, if set, bound the write of each request
+	conn         net.Conn
+	writeTimeout time.Duration
 }
 
 // NewMsgpClientCodec creates a new rpc.ClientCodec from an existing connection
 func NewMsgpClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
-	return msgpClientCodec{
-		dec: msgp.NewReader(conn),
-		enc: msgp.NewWriter(conn),
+	dec := msgpReaderPool.Get().(*msgp.Reader)
+	dec.Reset(conn)
+	enc := msgpWriterPool.Get().(*msgp.Writer)
+	enc.Reset(conn)
+	return &msgpClientCodec{
+		dec: dec,
+		enc: enc,
 		c:   conn,
 	}
 }
 
-func (c msgpClientCodec) Close() error {
-	return c.c.Close()
+// newMsgpClientCodecTimeout creates a new rpc.ClientCodec where each
+// request must be written within the timeout, after which the connection
+// is unusable. The deadline is set for each write under the lock held
+// by the rpc.Client while sending, so only applies to that request.
+func newMsgpClientCodecTimeout(conn net.Conn, writeTimeout time.Duration) rpc.ClientCodec {
+	c := NewMsgpClientCodec(conn).(*msgpClientCodec)
+	c.conn = conn
+	c.writeTimeout = writeTimeout
+	return c
+}
+
+func (c *msgpClientCodec) Close() error {
+	// Close the connection first to interrupt any blocked write
+	err := c.c.Close()
+	c.mu.Lock()
+	if c.enc != nil {
+		c.enc.Reset(nil)
+		msgpWriterPool.Put(c.enc)
+		c.enc = nil
+	}
+	c.mu.Unlock()
+	return err
+}
+
+func (c *msgpClientCodec) WriteRequest(r *rpc.Request, x interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.enc == nil {
+		return rpc.ErrShutdown
+	}
+	if c.conn != nil && c.writeTimeout > 0 {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return err
+		}
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	return c.writeRequest(r, x)
 }
 
-func (c msgpClientCodec) WriteRequest(r *rpc.Request, x interface{}) error {
+func (c *msgpClientCodec) writeRequest(r *rpc.Request, x interface{}) error {
 	if err := c.enc.WriteArrayHeader(4); err != nil {
 		return fmt.Errorf("WriteRequest failed in writing array header: %s", err)
 	}
@@ -67,7 +121,22 @@ func (c msgpClientCodec) WriteRequest(r *rpc.Request, x interface{}) error {
 	return nil
 }
 
-func (c msgpClientCodec) ReadResponseHeader(r *rpc.Response) error {
+func (c *msgpClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	if c.dec == nil {
+		return io.ErrUnexpectedEOF
+	}
+	err := c.readResponseHeader(r)
+	if err != nil {
+		// The rpc.Client stops reading after an error reading a header,
+		// so the reader can be reused
+		c.dec.Reset(nil)
+		msgpReaderPool.Put(c.dec)
+		c.dec = nil
+	}
+	return err
+}
+
+func (c *msgpClientCodec) readResponseHeader(r *rpc.Response) error {
 	sz, err := c.dec.ReadArrayHeader()
 	if err != nil || sz != 4 {
 		if cerr := knownError(err); cerr != nil {
@@ -114,13 +183,22 @@ func (c msgpClientCodec) ReadResponseHeader(r *rpc.Response) error {
 			}
 			return fmt.Errorf("ReadResponseHeader failed in error message: %s", err)
 		}
-		return fmt.Errorf("remote error: %s", rawerr)
+		// A remote error only fails this call, so the connection
+		// can still be used for other calls
+		r.Error = "remote error: " + rawerr
 	}
 	return nil
 }
 
-func (c msgpClientCodec) ReadResponseBody(x interface{}) error {
+func (c *msgpClientCodec) ReadResponseBody(x interface{}) error {
 	if x == nil {
+		// the body must still be consumed to keep the stream in sync
+		if err := c.dec.Skip(); err != nil {
+			if cerr := knownError(err); cerr != nil {
+				return cerr
+			}
+			return fmt.Errorf("ReadResponseBody failed in skipping body: %s", err)
+		}
 		return nil
 	}
 
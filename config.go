@@ -1,17 +1,23 @@
 package sigsci
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var (
+	// DefaultAgentConfig is the default value
+	DefaultAgentConfig = true
 	// DefaultAllowUnknownContentLength is the default value
 	DefaultAllowUnknownContentLength = false
 	// DefaultAnomalyDuration is the default value
@@ -32,53 +38,158 @@ var (
 	DefaultRPCNetwork = "unix"
 	// DefaultTimeout is the default value
 	DefaultTimeout = 100 * time.Millisecond
+	// DefaultDialTimeout is the default value
+	DefaultDialTimeout = time.Duration(0)
+	// DefaultReportTimeout is the default value
+	DefaultReportTimeout = time.Duration(0)
 	// DefaultServerIdentifier is the default value
 	DefaultServerIdentifier = runtime.Version()
 	// DefaultServerFlavor is the default value
 	DefaultServerFlavor = ""
+	// DefaultMinIdleConnections is the default value
+	DefaultMinIdleConnections = 0
+	// DefaultMaxIdleConnections is the default value
+	DefaultMaxIdleConnections = 0
+	// DefaultIdleConnectionTimeout is the default value
+	DefaultIdleConnectionTimeout = 30 * time.Second
+	// DefaultMultiplexConnections is the default value
+	DefaultMultiplexConnections = 0
+	// DefaultCircuitBreakerFailures is the default value
+	DefaultCircuitBreakerFailures = 0
+	// DefaultCircuitBreakerCooldown is the default value
+	DefaultCircuitBreakerCooldown = 5 * time.Second
+	// DefaultCircuitBreakerErrorRate is the default value
+	DefaultCircuitBreakerErrorRate = 0.0
+	// DefaultCircuitBreakerWindow is the default value
+	DefaultCircuitBreakerWindow = 0
+	// DefaultCircuitBreakerProbes is the default value
+	DefaultCircuitBreakerProbes = 1
+	// DefaultHealthCheckInterval is the default value
+	DefaultHealthCheckInterval = time.Duration(0)
+	// DefaultRegisterBackoffMin is the default value
+	DefaultRegisterBackoffMin = 1 * time.Second
+	// DefaultRegisterBackoffMax is the default value
+	DefaultRegisterBackoffMax = 1 * time.Minute
+	// DefaultLoadBalance is the default value
+	DefaultLoadBalance = BalanceFailover
+	// DefaultReportWorkers is the default value
+	DefaultReportWorkers = 0
+	// DefaultReportQueueSize is the default value
+	DefaultReportQueueSize = 0
+	// DefaultReportDropPolicy is the default value
+	DefaultReportDropPolicy = ReportDropNewest
+	// DefaultSpoolDir is the default value
+	DefaultSpoolDir = ""
+	// DefaultSpoolMaxBytes is the default value
+	DefaultSpoolMaxBytes = int64(0)
+	// DefaultReportBatchSize is the default value
+	DefaultReportBatchSize = 0
+	// DefaultReportBatchWindow is the default value
+	DefaultReportBatchWindow = time.Duration(0)
+	// DefaultStrictProtocol is the default value
+	DefaultStrictProtocol = false
 )
 
 // RawHeaderExtractorFunc is a header extraction function
 type RawHeaderExtractorFunc func(*http.Request) [][2]string
 
+// ReportResponseFunc is called with the agent's response to a report made
+// after the application responded, e.g. with tags from response-phase
+// findings. The in argument is set for a PostRequest report and in2 for an
+// UpdateRequest report. The messages must not be kept after the call.
+type ReportResponseFunc func(in *RPCMsgIn, in2 *RPCMsgIn2, out *RPCMsgOut)
+
 // ModuleConfig is a configuration object for a Module
 type ModuleConfig struct {
+	agentConfig               bool
+	agentContentTypes         []string
+	agentOverrides            atomic.Value // *agentOverrides
 	allowUnknownContentLength bool
 	anomalyDuration           time.Duration
 	anomalySize               int64
+	balancePolicy             BalancePolicy
+	breakerCooldown           time.Duration
+	breakerErrorRate          float64
+	breakerFailures           int
+	breakerProbes             int
+	breakerWindow             int
 	expectedContentTypes      []string
 	extendContentTypes        bool
 	debug                     bool
+	dialTimeout               time.Duration
 	rawHeaderExtractor        RawHeaderExtractorFunc
+	healthCheckInterval       time.Duration
+	idleConnectionTimeout     time.Duration
 	inspector                 Inspector
 	inspInit                  InspectorInitFunc
 	inspFini                  InspectorFiniFunc
 	maxContentLength          int64
+	maxIdleConnections        int
+	minIdleConnections        int
 	moduleIdentifier          string
+	multiplexConnections      int
+	registerBackoffMax        time.Duration
+	registerBackoffMin        time.Duration
+	reportBatchSize           int
+	reportBatchWindow         time.Duration
+	reportPolicy              ReportPolicy
+	reportQueueSize           int
+	reportResponseHandler     ReportResponseFunc
+	reportTimeout             time.Duration
+	reportWorkers             int
 	rpcAddress                string
+	rpcEndpoints              []RPCEndpoint
 	rpcNetwork                string
+	rpcTLSConfig              *tls.Config
 	serverIdentifier          string
 	serverFlavor              string
+	spoolDir                  string
+	spoolMaxBytes             int64
+	strictProtocol            bool
 	timeout                   time.Duration
 }
 
 // NewModuleConfig returns an object with any options set
 func NewModuleConfig(options ...ModuleConfigOption) (*ModuleConfig, error) {
 	c := &ModuleConfig{
+		agentConfig:               DefaultAgentConfig,
 		allowUnknownContentLength: DefaultAllowUnknownContentLength,
 		anomalyDuration:           DefaultAnomalyDuration,
 		anomalySize:               DefaultAnomalySize,
+		balancePolicy:             DefaultLoadBalance,
+		breakerCooldown:           DefaultCircuitBreakerCooldown,
+		breakerErrorRate:          DefaultCircuitBreakerErrorRate,
+		breakerFailures:           DefaultCircuitBreakerFailures,
+		breakerProbes:             DefaultCircuitBreakerProbes,
+		breakerWindow:             DefaultCircuitBreakerWindow,
 		expectedContentTypes:      make([]string, 0),
 		debug:                     DefaultDebug,
+		dialTimeout:               DefaultDialTimeout,
+		healthCheckInterval:       DefaultHealthCheckInterval,
+		idleConnectionTimeout:     DefaultIdleConnectionTimeout,
 		inspector:                 DefaultInspector,
 		inspInit:                  nil,
 		inspFini:                  nil,
 		maxContentLength:          DefaultMaxContentLength,
+		maxIdleConnections:        DefaultMaxIdleConnections,
+		minIdleConnections:        DefaultMinIdleConnections,
 		moduleIdentifier:          DefaultModuleIdentifier,
+		multiplexConnections:      DefaultMultiplexConnections,
+		registerBackoffMax:        DefaultRegisterBackoffMax,
+		registerBackoffMin:        DefaultRegisterBackoffMin,
+		reportBatchSize:           DefaultReportBatchSize,
+		reportBatchWindow:         DefaultReportBatchWindow,
+		reportPolicy:              DefaultReportDropPolicy,
+		reportQueueSize:           DefaultReportQueueSize,
+		reportTimeout:             DefaultReportTimeout,
+		reportWorkers:             DefaultReportWorkers,
 		rpcAddress:                DefaultRPCAddress,
 		rpcNetwork:                DefaultRPCNetwork,
 		serverIdentifier:          DefaultServerIdentifier,
 		serverFlavor:              DefaultServerFlavor,
+		spoolDir:                  DefaultSpoolDir,
+		spoolMaxBytes:             DefaultSpoolMaxBytes,
+		strictProtocol:            DefaultStrictProtocol,
 		timeout:                   DefaultTimeout,
 	}
 	if err := c.SetOptions(options...); err != nil {
@@ -119,9 +230,26 @@ func (c *ModuleConfig) IsExpectedContentType(s string) bool {
 			return true
 		}
 	}
+	if o := c.overrides(); o != nil {
+		for _, ct := range o.expectedContentTypes {
+			if strings.HasPrefix(s, ct) {
+				return true
+			}
+		}
+	}
 	return false
 }
 
+// AgentConfig returns the configuration value
+func (c *ModuleConfig) AgentConfig() bool {
+	return c.agentConfig
+}
+
+// AgentContentTypes returns the configuration value
+func (c *ModuleConfig) AgentContentTypes() []string {
+	return c.agentContentTypes
+}
+
 // AllowUnknownContentLength returns the configuration value
 func (c *ModuleConfig) AllowUnknownContentLength() bool {
 	return c.allowUnknownContentLength
@@ -140,17 +268,59 @@ func (c *ModuleConfig) AltResponseCodes() []int {
 
 // AnomalyDuration returns the configuration value
 func (c *ModuleConfig) AnomalyDuration() time.Duration {
+	if o := c.overrides(); o != nil && o.anomalyDuration > 0 {
+		return o.anomalyDuration
+	}
 	return c.anomalyDuration
 }
 
 // AnomalySize returns the configuration value
 func (c *ModuleConfig) AnomalySize() int64 {
+	if o := c.overrides(); o != nil && o.anomalySize > 0 {
+		return o.anomalySize
+	}
 	return c.anomalySize
 }
 
+// LoadBalance returns the configuration value
+func (c *ModuleConfig) LoadBalance() BalancePolicy {
+	return c.balancePolicy
+}
+
+// CircuitBreakerFailures returns the configuration value
+func (c *ModuleConfig) CircuitBreakerFailures() int {
+	return c.breakerFailures
+}
+
+// CircuitBreakerCooldown returns the configuration value
+func (c *ModuleConfig) CircuitBreakerCooldown() time.Duration {
+	return c.breakerCooldown
+}
+
+// CircuitBreakerErrorRate returns the configuration value
+func (c *ModuleConfig) CircuitBreakerErrorRate() float64 {
+	return c.breakerErrorRate
+}
+
+// CircuitBreakerWindow returns the configuration value
+func (c *ModuleConfig) CircuitBreakerWindow() int {
+	return c.breakerWindow
+}
+
+// CircuitBreakerProbes returns the configuration value
+func (c *ModuleConfig) CircuitBreakerProbes() int {
+	return c.breakerProbes
+}
+
 // ExpectedContentTypes returns the slice of additional custom content types
 func (c *ModuleConfig) ExpectedContentTypes() []string {
-	return c.expectedContentTypes
+	o := c.overrides()
+	if o == nil || len(o.expectedContentTypes) == 0 {
+		return c.expectedContentTypes
+	}
+	types := make([]string, 0, len(c.expectedContentTypes)+len(o.expectedContentTypes))
+	types = append(types, c.expectedContentTypes...)
+	return append(types, o.expectedContentTypes...)
 }
 
 // Debug returns the configuration value
@@ -158,11 +328,26 @@ func (c *ModuleConfig) Debug() bool {
 	return c.debug
 }
 
+// DialTimeout returns the configuration value
+func (c *ModuleConfig) DialTimeout() time.Duration {
+	return c.dialTimeout
+}
+
 // RawHeaderExtractor returns the configuration value
 func (c *ModuleConfig) RawHeaderExtractor() RawHeaderExtractorFunc {
 	return c.rawHeaderExtractor
 }
 
+// HealthCheckInterval returns the configuration value
+func (c *ModuleConfig) HealthCheckInterval() time.Duration {
+	return c.healthCheckInterval
+}
+
+// IdleConnectionTimeout returns the configuration value
+func (c *ModuleConfig) IdleConnectionTimeout() time.Duration {
+	return c.idleConnectionTimeout
+}
+
 // Inspector returns the inspector
 func (c *ModuleConfig) Inspector() Inspector {
 	return c.inspector
@@ -180,14 +365,37 @@ func (c *ModuleConfig) InspectorFini() InspectorFiniFunc {
 
 // MaxContentLength returns the configuration value
 func (c *ModuleConfig) MaxContentLength() int64 {
+	if o := c.overrides(); o != nil && o.maxContentLength > 0 {
+		return o.maxContentLength
+	}
 	return c.maxContentLength
 }
 
+// MaxIdleConnections returns the configuration value
+func (c *ModuleConfig) MaxIdleConnections() int {
+	return c.maxIdleConnections
+}
+
+// MinIdleConnections returns the configuration value
+func (c *ModuleConfig) MinIdleConnections() int {
+	return c.minIdleConnections
+}
+
 // ModuleIdentifier returns the configuration value
 func (c *ModuleConfig) ModuleIdentifier() string {
 	return c.moduleIdentifier
 }
 
+// MultiplexConnections returns the configuration value
+func (c *ModuleConfig) MultiplexConnections() int {
+	return c.multiplexConnections
+}
+
+// RegisterBackoff returns the minimum and maximum configuration values
+func (c *ModuleConfig) RegisterBackoff() (time.Duration, time.Duration) {
+	return c.registerBackoffMin, c.registerBackoffMax
+}
+
 // RPCAddress returns the configuration value
 func (c *ModuleConfig) RPCAddress() string {
 	return c.rpcAddress
@@ -198,6 +406,19 @@ func (c *ModuleConfig) RPCNetwork() string {
 	return c.rpcNetwork
 }
 
+// RPCEndpoints returns all configured agent endpoints in order, starting
+// with the RPCNetwork/RPCAddress endpoint
+func (c *ModuleConfig) RPCEndpoints() []RPCEndpoint {
+	endpoints := make([]RPCEndpoint, 0, len(c.rpcEndpoints)+1)
+	endpoints = append(endpoints, RPCEndpoint{Network: c.rpcNetwork, Address: c.rpcAddress})
+	return append(endpoints, c.rpcEndpoints...)
+}
+
+// RPCTLSConfig returns the configuration value
+func (c *ModuleConfig) RPCTLSConfig() *tls.Config {
+	return c.rpcTLSConfig
+}
+
 // RPCAddressString returns the RPCNetwork/RPCAddress as a combined string
 func (c *ModuleConfig) RPCAddressString() string {
 	return c.rpcNetwork + ":" + c.rpcAddress
@@ -213,6 +434,56 @@ func (c *ModuleConfig) ServerFlavor() string {
 	return c.serverFlavor
 }
 
+// ReportBatchSize returns the configuration value
+func (c *ModuleConfig) ReportBatchSize() int {
+	return c.reportBatchSize
+}
+
+// ReportBatchWindow returns the configuration value
+func (c *ModuleConfig) ReportBatchWindow() time.Duration {
+	return c.reportBatchWindow
+}
+
+// ReportDropPolicy returns the configuration value
+func (c *ModuleConfig) ReportDropPolicy() ReportPolicy {
+	return c.reportPolicy
+}
+
+// ReportQueueSize returns the configuration value
+func (c *ModuleConfig) ReportQueueSize() int {
+	return c.reportQueueSize
+}
+
+// ReportWorkers returns the configuration value
+func (c *ModuleConfig) ReportWorkers() int {
+	return c.reportWorkers
+}
+
+// ReportResponseHandler returns the configuration value
+func (c *ModuleConfig) ReportResponseHandler() ReportResponseFunc {
+	return c.reportResponseHandler
+}
+
+// ReportTimeout returns the configuration value
+func (c *ModuleConfig) ReportTimeout() time.Duration {
+	return c.reportTimeout
+}
+
+// SpoolDir returns the configuration value
+func (c *ModuleConfig) SpoolDir() string {
+	return c.spoolDir
+}
+
+// SpoolMaxBytes returns the configuration value
+func (c *ModuleConfig) SpoolMaxBytes() int64 {
+	return c.spoolMaxBytes
+}
+
+// StrictProtocol returns the configuration value
+func (c *ModuleConfig) StrictProtocol() bool {
+	return c.strictProtocol
+}
+
 // Timeout returns the configuration value
 func (c *ModuleConfig) Timeout() time.Duration {
 	return c.timeout
@@ -224,6 +495,35 @@ func (c *ModuleConfig) Timeout() time.Duration {
 // See: https://dave.cheney.net/2014/10/17/functional-options-for-friendly-apis
 type ModuleConfigOption func(*ModuleConfig) error
 
+// AgentConfig is a function argument to accept module configuration from
+// the agent, sent in reply to each ModuleInit call. The configuration is
+// applied to the live module configuration, with the values set by the
+// module's own options as limits the agent cannot exceed: the agent can
+// lower the MaxContentLength, AnomalySize and AnomalyDuration values, and
+// add ExpectedContentType values listed by AgentContentTypes. This is
+// enabled by default.
+//
+// ModuleInit is called at startup and when the module registers again
+// after the agent was unavailable, so the configuration is only refreshed
+// periodically if the HealthCheck option is set.
+func AgentConfig(enable bool) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		c.agentConfig = enable
+		return nil
+	}
+}
+
+// AgentContentTypes is a function argument that adds Content-Types the
+// agent may add to the ExpectedContentType values (see AgentConfig).
+// Other Content-Types from the agent are ignored, so by default the agent
+// cannot add any.
+func AgentContentTypes(types ...string) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		c.agentContentTypes = append(c.agentContentTypes, types...)
+		return nil
+	}
+}
+
 // AllowUnknownContentLength is a function argument to set the ability
 // to read the body when the content length is not specified.
 //
@@ -270,6 +570,51 @@ func AnomalySize(size int64) ModuleConfigOption {
 	}
 }
 
+// CircuitBreaker is a function argument to stop calling the inspector after
+// the given number of consecutive failures, failing open immediately instead
+// of waiting for the timeout on every request. After the cooldown, probe
+// calls are made to the inspector to decide if it has recovered. Zero
+// failures disables this check.
+func CircuitBreaker(failures int, cooldown time.Duration) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if failures < 0 {
+			return errors.New("circuit breaker failures must not be negative")
+		}
+		c.breakerFailures = failures
+		c.breakerCooldown = cooldown
+		return nil
+	}
+}
+
+// CircuitBreakerErrorRate is a function argument to also open the circuit
+// breaker when the rate of failed inspector calls (0.0-1.0) over the last
+// window calls reaches the given rate. A zero rate disables this check.
+func CircuitBreakerErrorRate(rate float64, window int) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if rate < 0 || rate > 1 {
+			return errors.New("circuit breaker error rate must be between 0.0 and 1.0")
+		}
+		if rate > 0 && window < 1 {
+			return errors.New("circuit breaker window must be positive")
+		}
+		c.breakerErrorRate = rate
+		c.breakerWindow = window
+		return nil
+	}
+}
+
+// CircuitBreakerProbes is a function argument to set the number of
+// successful probe calls required to close an open circuit breaker
+func CircuitBreakerProbes(n int) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if n < 1 {
+			return errors.New("circuit breaker probes must be positive")
+		}
+		c.breakerProbes = n
+		return nil
+	}
+}
+
 // ExpectedContentType is a function argument that adds a custom Content-Type
 // that should have request bodies sent to the agent for inspection
 func ExpectedContentType(s string) ModuleConfigOption {
@@ -318,6 +663,196 @@ func Debug(enable bool) ModuleConfigOption {
 	}
 }
 
+// StrictProtocol is a function argument to surface inspector responses
+// that violate the protocol (e.g., an invalid header name) as errors. By
+// default, the violation is logged and the invalid parts of the response
+// are ignored, with the rest (e.g., the decision to block) still applied.
+// In strict mode, the request fails with a 502 Bad Gateway response with the error,
+// and a report fails with the error, which is intended for tests.
+func StrictProtocol(enable bool) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		c.strictProtocol = enable
+		return nil
+	}
+}
+
+// HealthCheck is a function argument to probe the agent in the background
+// at the given interval so that the agent status reported by the module
+// (e.g., Module.Healthy) is kept current without any traffic. The probe is
+// a ModuleInit call, so this also acts as a periodic heartbeat keeping the
+// module registered with the agent. A zero interval disables the
+// background probe.
+func HealthCheck(interval time.Duration) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if interval < 0 {
+			return errors.New("health check interval must not be negative")
+		}
+		c.healthCheckInterval = interval
+		return nil
+	}
+}
+
+// RegisterBackoff is a function argument to set the minimum and maximum
+// time between retries when registering the module with the agent (via
+// ModuleInit) fails. Registration is retried when the agent is unavailable
+// at startup and whenever the agent becomes reachable again after a failure
+// (e.g., the agent restarted), starting at min and doubling up to max.
+func RegisterBackoff(min, max time.Duration) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if min <= 0 || max < min {
+			return errors.New("register backoff min must be positive and not greater than max")
+		}
+		c.registerBackoffMin = min
+		c.registerBackoffMax = max
+		return nil
+	}
+}
+
+// ReportQueue is a function argument to make the background reports
+// (PostRequest and UpdateRequest calls made after the response) with a
+// fixed number of workers taking reports from a queue of the given size,
+// instead of using a goroutine per report. This bounds the resources used
+// while the agent is slow, at the cost of dropping reports (see
+// ReportDropPolicy) when the queue is full. Zero workers uses a goroutine
+// per report. A zero size queue only holds a report while a worker takes
+// it, so cannot be used with ReportDropOldest.
+func ReportQueue(workers, size int) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if workers < 0 {
+			return errors.New("report workers must not be negative")
+		}
+		if size < 0 {
+			return errors.New("report queue size must not be negative")
+		}
+		if workers > 0 && size == 0 && c.reportPolicy == ReportDropOldest {
+			return errors.New("report queue size must not be zero to drop the oldest reports")
+		}
+		c.reportWorkers = workers
+		c.reportQueueSize = size
+		return nil
+	}
+}
+
+// ReportDropPolicy is a function argument to set what happens to a
+// background report when the report queue is full
+func ReportDropPolicy(policy ReportPolicy) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		switch policy {
+		case ReportDropNewest, ReportDropOldest, ReportBlock:
+		default:
+			return fmt.Errorf("invalid report drop policy %d", policy)
+		}
+		if policy == ReportDropOldest && c.reportWorkers > 0 && c.reportQueueSize == 0 {
+			return errors.New("report queue size must not be zero to drop the oldest reports")
+		}
+		c.reportPolicy = policy
+		return nil
+	}
+}
+
+// ReportBatch is a function argument to coalesce background reports
+// (PostRequest and UpdateRequest calls made after the response) into
+// batches sent to the agent in a single call, reducing the load on the
+// agent at high request rates. A batch is sent once it has size reports
+// or once window has passed since the first report in the batch. If the
+// agent does not support batches, the reports are sent individually. A
+// zero size disables batching.
+func ReportBatch(size int, window time.Duration) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if size < 0 {
+			return errors.New("report batch size must not be negative")
+		}
+		if size > 0 && window <= 0 {
+			return errors.New("report batch window must be positive")
+		}
+		c.reportBatchSize = size
+		c.reportBatchWindow = window
+		return nil
+	}
+}
+
+// ReportResponseHandler is a function argument to set a function called
+// in the background with the agent's response to a report (PostRequest and
+// UpdateRequest calls made after the response), if the agent responds with
+// more than a success. Reports sent in a batch (see ReportBatch) or from
+// the spool (see Spool) have no individual responses.
+func ReportResponseHandler(fn ReportResponseFunc) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		c.reportResponseHandler = fn
+		return nil
+	}
+}
+
+// Spool is a function argument to keep background reports (PostRequest
+// and UpdateRequest calls made after the response) that fail to be sent to
+// the agent in files in dir, which are sent once the agent is reachable
+// again, including by a later run of the application. Up to maxBytes of
+// reports are kept, with the oldest reports removed to make room for new
+// ones. Reports rejected by the agent itself are not kept. A spool file
+// that cannot be read back is renamed with a .bad suffix and not replayed.
+//
+// The reports are written to disk in plaintext, including the request
+// headers (e.g., Cookie and Authorization), so dir should only be readable
+// by the application.
+func Spool(dir string, maxBytes int64) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if dir == "" {
+			return errors.New("spool directory must be set")
+		}
+		if maxBytes <= 0 {
+			return errors.New("spool size must be positive")
+		}
+		c.spoolDir = dir
+		c.spoolMaxBytes = maxBytes
+		return nil
+	}
+}
+
+// ConnectionPool is a function argument to keep connections to the agent
+// open for reuse instead of connecting to the agent for each call. Up to
+// maxIdle connections are kept open while idle, with at least minIdle
+// connections kept open regardless of the idle connection timeout. A
+// maxIdle of zero disables connection pooling.
+func ConnectionPool(minIdle, maxIdle int) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if minIdle < 0 || maxIdle < 0 {
+			return errors.New("connection pool sizes must not be negative")
+		}
+		if minIdle > maxIdle {
+			return errors.New("connection pool minIdle must not be greater than maxIdle")
+		}
+		c.minIdleConnections = minIdle
+		c.maxIdleConnections = maxIdle
+		return nil
+	}
+}
+
+// IdleConnectionTimeout is a function argument to set how long a pooled
+// connection to the agent is kept open while idle. A zero duration keeps
+// idle connections open indefinitely.
+func IdleConnectionTimeout(t time.Duration) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		c.idleConnectionTimeout = t
+		return nil
+	}
+}
+
+// MultiplexConnections is a function argument to share n long-lived
+// connections to the agent between all concurrent calls instead of using
+// a connection per call. A call timing out does not close the shared
+// connection, and a closed connection is reconnected on the next call.
+// This takes precedence over the ConnectionPool option. Zero disables
+// multiplexing.
+func MultiplexConnections(n int) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if n < 0 {
+			return errors.New("multiplex connections must not be negative")
+		}
+		c.multiplexConnections = n
+		return nil
+	}
+}
+
 // MaxContentLength is a function argument to set the maximum post
 // body length that will be processed
 func MaxContentLength(size int64) ModuleConfigOption {
@@ -333,17 +868,8 @@ func MaxContentLength(size int64) ModuleConfigOption {
 // path or an `address:port`, respectively.
 func Socket(network, address string) ModuleConfigOption {
 	return func(c *ModuleConfig) error {
-		switch network {
-		case "unix":
-			if !filepath.IsAbs(address) {
-				return errors.New(`address must be an absolute path for network="unix"`)
-			}
-		case "tcp":
-			if _, _, err := net.SplitHostPort(address); err != nil {
-				return fmt.Errorf(`address must be in "address:port" form for network="tcp": %s`, err)
-			}
-		default:
-			return errors.New(`network must be "tcp" or "unix"`)
+		if err := validateSocket(network, address); err != nil {
+			return err
 		}
 
 		c.rpcNetwork = network
@@ -353,9 +879,117 @@ func Socket(network, address string) ModuleConfigOption {
 	}
 }
 
+// SocketTLS is a function argument to send data to the Signal Sciences
+// Agent over a TLS connection to the given `address:port`. The TLS config
+// sets the CA certificates used to verify the agent (RootCAs), the expected
+// agent server name (ServerName, which defaults to the host in the address)
+// and any client certificates for mutual TLS (Certificates). The TLS config
+// is used for all `tcp` agent endpoints, including any FailoverSocket.
+// See NewAgentTLSConfig to create a TLS config from files.
+func SocketTLS(address string, config *tls.Config) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if err := validateSocket("tcp", address); err != nil {
+			return err
+		}
+		if config == nil {
+			return errors.New("TLS config must not be nil")
+		}
+
+		c.rpcNetwork = "tcp"
+		c.rpcAddress = address
+		c.rpcTLSConfig = config
+
+		return nil
+	}
+}
+
+// NewAgentTLSConfig creates a TLS config for SocketTLS. The PEM encoded CA
+// file is used to verify the agent certificate instead of the system CAs if
+// not empty. The PEM encoded client certificate and key files are used for
+// mutual TLS if not empty. The server name is the name expected in the
+// agent certificate, which defaults to the host in the agent address.
+func NewAgentTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates found in %q", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// FailoverSocket is a function argument to add another Signal Sciences
+// Agent endpoint after the one set via Socket, in the same form as
+// Socket. Endpoints are used in the order they are added, failing over
+// to the next endpoint if an endpoint is unavailable, unless another
+// LoadBalance policy is set. Hostnames in `tcp` addresses are resolved
+// again when reconnecting after a failure.
+func FailoverSocket(network, address string) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		if err := validateSocket(network, address); err != nil {
+			return err
+		}
+
+		c.rpcEndpoints = append(c.rpcEndpoints, RPCEndpoint{Network: network, Address: address})
+
+		return nil
+	}
+}
+
+// LoadBalance is a function argument to set how calls are spread over
+// multiple agent endpoints (see FailoverSocket)
+func LoadBalance(policy BalancePolicy) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		switch policy {
+		case BalanceFailover, BalanceRoundRobin, BalanceLeastLatency:
+		default:
+			return fmt.Errorf("invalid balance policy %d", policy)
+		}
+		c.balancePolicy = policy
+		return nil
+	}
+}
+
+func validateSocket(network, address string) error {
+	switch network {
+	case "unix":
+		if !filepath.IsAbs(address) {
+			return errors.New(`address must be an absolute path for network="unix"`)
+		}
+	case "tcp":
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf(`address must be in "address:port" form for network="tcp": %s`, err)
+		}
+	default:
+		return errors.New(`network must be "tcp" or "unix"`)
+	}
+	return nil
+}
+
 // Timeout is a function argument that sets the maximum time to wait until
 // receiving a reply from the inspector. Once this timeout is reached, the
-// module will fail open.
+// module will fail open. This applies to the inspection made before the
+// request is handled, so should be kept short. Unless a DialTimeout is
+// set, this includes any time to connect to the agent, and otherwise it
+// starts once connected.
 func Timeout(t time.Duration) ModuleConfigOption {
 	return func(c *ModuleConfig) error {
 		c.timeout = t
@@ -363,6 +997,30 @@ func Timeout(t time.Duration) ModuleConfigOption {
 	}
 }
 
+// DialTimeout is a function argument that sets the maximum time to wait
+// while connecting to the agent, so that an unreachable agent is detected
+// (or the next agent endpoint is tried) without waiting for the whole
+// call timeout, which then starts once connected. A zero duration only
+// limits connecting by the call timeout.
+func DialTimeout(t time.Duration) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		c.dialTimeout = t
+		return nil
+	}
+}
+
+// ReportTimeout is a function argument that sets the maximum time to wait
+// for the agent to accept the response data reported in the background
+// after the request is handled. As this does not delay the response, it
+// can be more generous than the Timeout to avoid losing response data. A
+// zero duration uses the Timeout.
+func ReportTimeout(t time.Duration) ModuleConfigOption {
+	return func(c *ModuleConfig) error {
+		c.reportTimeout = t
+		return nil
+	}
+}
+
 // ModuleIdentifier is a function argument that sets the module name
 // and version for custom setups.
 // The version should be a sem-version (e.g., "1.2.3")
@@ -1,7 +1,9 @@
 package sigsci
 
 import (
+	"crypto/tls"
 	"net/http"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -32,6 +34,18 @@ func TestDefaultModuleConfig(t *testing.T) {
 	if c.RawHeaderExtractor() != nil {
 		t.Errorf("Unexpected RawHeaderExtractor: %p", c.RawHeaderExtractor())
 	}
+	if c.ReportResponseHandler() != nil {
+		t.Errorf("Unexpected ReportResponseHandler: %p", c.ReportResponseHandler())
+	}
+	if len(c.AgentContentTypes()) != 0 {
+		t.Errorf("Unexpected AgentContentTypes: %q", c.AgentContentTypes())
+	}
+	if c.StrictProtocol() != DefaultStrictProtocol {
+		t.Errorf("Unexpected StrictProtocol: %v", c.StrictProtocol())
+	}
+	if c.RPCTLSConfig() != nil {
+		t.Errorf("Unexpected RPCTLSConfig: %v", c.RPCTLSConfig())
+	}
 	if c.Inspector() != DefaultInspector {
 		t.Errorf("Unexpected Inspector: %v", c.Inspector())
 	}
@@ -62,6 +76,72 @@ func TestDefaultModuleConfig(t *testing.T) {
 	if c.Timeout() != DefaultTimeout {
 		t.Errorf("Unexpected Timeout: %v", c.Timeout())
 	}
+	if c.DialTimeout() != DefaultDialTimeout {
+		t.Errorf("Unexpected DialTimeout: %v", c.DialTimeout())
+	}
+	if c.ReportTimeout() != DefaultReportTimeout {
+		t.Errorf("Unexpected ReportTimeout: %v", c.ReportTimeout())
+	}
+	if c.ReportWorkers() != DefaultReportWorkers {
+		t.Errorf("Unexpected ReportWorkers: %v", c.ReportWorkers())
+	}
+	if c.ReportQueueSize() != DefaultReportQueueSize {
+		t.Errorf("Unexpected ReportQueueSize: %v", c.ReportQueueSize())
+	}
+	if c.ReportDropPolicy() != DefaultReportDropPolicy {
+		t.Errorf("Unexpected ReportDropPolicy: %v", c.ReportDropPolicy())
+	}
+	if c.ReportBatchSize() != DefaultReportBatchSize {
+		t.Errorf("Unexpected ReportBatchSize: %v", c.ReportBatchSize())
+	}
+	if c.ReportBatchWindow() != DefaultReportBatchWindow {
+		t.Errorf("Unexpected ReportBatchWindow: %v", c.ReportBatchWindow())
+	}
+	if c.SpoolDir() != DefaultSpoolDir {
+		t.Errorf("Unexpected SpoolDir: %v", c.SpoolDir())
+	}
+	if c.SpoolMaxBytes() != DefaultSpoolMaxBytes {
+		t.Errorf("Unexpected SpoolMaxBytes: %v", c.SpoolMaxBytes())
+	}
+	if c.MinIdleConnections() != DefaultMinIdleConnections {
+		t.Errorf("Unexpected MinIdleConnections: %v", c.MinIdleConnections())
+	}
+	if c.MaxIdleConnections() != DefaultMaxIdleConnections {
+		t.Errorf("Unexpected MaxIdleConnections: %v", c.MaxIdleConnections())
+	}
+	if c.IdleConnectionTimeout() != DefaultIdleConnectionTimeout {
+		t.Errorf("Unexpected IdleConnectionTimeout: %v", c.IdleConnectionTimeout())
+	}
+	if c.MultiplexConnections() != DefaultMultiplexConnections {
+		t.Errorf("Unexpected MultiplexConnections: %v", c.MultiplexConnections())
+	}
+	if c.CircuitBreakerFailures() != DefaultCircuitBreakerFailures {
+		t.Errorf("Unexpected CircuitBreakerFailures: %v", c.CircuitBreakerFailures())
+	}
+	if c.CircuitBreakerCooldown() != DefaultCircuitBreakerCooldown {
+		t.Errorf("Unexpected CircuitBreakerCooldown: %v", c.CircuitBreakerCooldown())
+	}
+	if c.CircuitBreakerErrorRate() != DefaultCircuitBreakerErrorRate {
+		t.Errorf("Unexpected CircuitBreakerErrorRate: %v", c.CircuitBreakerErrorRate())
+	}
+	if c.CircuitBreakerWindow() != DefaultCircuitBreakerWindow {
+		t.Errorf("Unexpected CircuitBreakerWindow: %v", c.CircuitBreakerWindow())
+	}
+	if c.CircuitBreakerProbes() != DefaultCircuitBreakerProbes {
+		t.Errorf("Unexpected CircuitBreakerProbes: %v", c.CircuitBreakerProbes())
+	}
+	if c.HealthCheckInterval() != DefaultHealthCheckInterval {
+		t.Errorf("Unexpected HealthCheckInterval: %v", c.HealthCheckInterval())
+	}
+	if min, max := c.RegisterBackoff(); min != DefaultRegisterBackoffMin || max != DefaultRegisterBackoffMax {
+		t.Errorf("Unexpected RegisterBackoff: %v, %v", min, max)
+	}
+	if c.LoadBalance() != DefaultLoadBalance {
+		t.Errorf("Unexpected LoadBalance: %v", c.LoadBalance())
+	}
+	if eps := c.RPCEndpoints(); !reflect.DeepEqual(eps, []RPCEndpoint{{Network: DefaultRPCNetwork, Address: DefaultRPCAddress}}) {
+		t.Errorf("Unexpected RPCEndpoints: %v", eps)
+	}
 	for code := 300; code < 600; code++ {
 		if c.IsAllowCode(code) {
 			t.Errorf("Unexpected IsAllowCode(%d): %v", code, c.IsAllowCode(code))
@@ -97,6 +177,22 @@ func TestConfiguredModuleConfig(t *testing.T) {
 		MaxContentLength(500000),
 		Socket("tcp", "0.0.0.0:1234"),
 		Timeout(10*time.Millisecond),
+		DialTimeout(5*time.Millisecond),
+		ReportTimeout(time.Second),
+		ReportQueue(4, 100),
+		ReportDropPolicy(ReportDropOldest),
+		ReportBatch(50, 10*time.Millisecond),
+		Spool("/var/spool/sigsci", 1<<20),
+		ConnectionPool(1, 4),
+		IdleConnectionTimeout(time.Minute),
+		MultiplexConnections(2),
+		CircuitBreaker(5, time.Minute),
+		CircuitBreakerErrorRate(0.5, 100),
+		CircuitBreakerProbes(3),
+		HealthCheck(10*time.Second),
+		RegisterBackoff(time.Second, 10*time.Second),
+		FailoverSocket("tcp", "agent.example.com:1234"),
+		LoadBalance(BalanceRoundRobin),
 	)
 	if err != nil {
 		t.Fatalf("Failed to create module config: %s", err)
@@ -152,6 +248,72 @@ func TestConfiguredModuleConfig(t *testing.T) {
 	if c.Timeout() != 10*time.Millisecond {
 		t.Errorf("Unexpected Timeout: %v", c.Timeout())
 	}
+	if c.DialTimeout() != 5*time.Millisecond {
+		t.Errorf("Unexpected DialTimeout: %v", c.DialTimeout())
+	}
+	if c.ReportTimeout() != time.Second {
+		t.Errorf("Unexpected ReportTimeout: %v", c.ReportTimeout())
+	}
+	if c.ReportWorkers() != 4 {
+		t.Errorf("Unexpected ReportWorkers: %v", c.ReportWorkers())
+	}
+	if c.ReportQueueSize() != 100 {
+		t.Errorf("Unexpected ReportQueueSize: %v", c.ReportQueueSize())
+	}
+	if c.ReportDropPolicy() != ReportDropOldest {
+		t.Errorf("Unexpected ReportDropPolicy: %v", c.ReportDropPolicy())
+	}
+	if c.ReportBatchSize() != 50 {
+		t.Errorf("Unexpected ReportBatchSize: %v", c.ReportBatchSize())
+	}
+	if c.ReportBatchWindow() != 10*time.Millisecond {
+		t.Errorf("Unexpected ReportBatchWindow: %v", c.ReportBatchWindow())
+	}
+	if c.SpoolDir() != "/var/spool/sigsci" {
+		t.Errorf("Unexpected SpoolDir: %v", c.SpoolDir())
+	}
+	if c.SpoolMaxBytes() != 1<<20 {
+		t.Errorf("Unexpected SpoolMaxBytes: %v", c.SpoolMaxBytes())
+	}
+	if c.MinIdleConnections() != 1 {
+		t.Errorf("Unexpected MinIdleConnections: %v", c.MinIdleConnections())
+	}
+	if c.MaxIdleConnections() != 4 {
+		t.Errorf("Unexpected MaxIdleConnections: %v", c.MaxIdleConnections())
+	}
+	if c.IdleConnectionTimeout() != time.Minute {
+		t.Errorf("Unexpected IdleConnectionTimeout: %v", c.IdleConnectionTimeout())
+	}
+	if c.MultiplexConnections() != 2 {
+		t.Errorf("Unexpected MultiplexConnections: %v", c.MultiplexConnections())
+	}
+	if c.CircuitBreakerFailures() != 5 {
+		t.Errorf("Unexpected CircuitBreakerFailures: %v", c.CircuitBreakerFailures())
+	}
+	if c.CircuitBreakerCooldown() != time.Minute {
+		t.Errorf("Unexpected CircuitBreakerCooldown: %v", c.CircuitBreakerCooldown())
+	}
+	if c.CircuitBreakerErrorRate() != 0.5 {
+		t.Errorf("Unexpected CircuitBreakerErrorRate: %v", c.CircuitBreakerErrorRate())
+	}
+	if c.CircuitBreakerWindow() != 100 {
+		t.Errorf("Unexpected CircuitBreakerWindow: %v", c.CircuitBreakerWindow())
+	}
+	if c.CircuitBreakerProbes() != 3 {
+		t.Errorf("Unexpected CircuitBreakerProbes: %v", c.CircuitBreakerProbes())
+	}
+	if c.HealthCheckInterval() != 10*time.Second {
+		t.Errorf("Unexpected HealthCheckInterval: %v", c.HealthCheckInterval())
+	}
+	if min, max := c.RegisterBackoff(); min != time.Second || max != 10*time.Second {
+		t.Errorf("Unexpected RegisterBackoff: %v, %v", min, max)
+	}
+	if c.LoadBalance() != BalanceRoundRobin {
+		t.Errorf("Unexpected LoadBalance: %v", c.LoadBalance())
+	}
+	if eps := c.RPCEndpoints(); !reflect.DeepEqual(eps, []RPCEndpoint{{Network: "tcp", Address: "0.0.0.0:1234"}, {Network: "tcp", Address: "agent.example.com:1234"}}) {
+		t.Errorf("Unexpected RPCEndpoints: %v", eps)
+	}
 	for code := 300; code < 600; code++ {
 		if c.IsAllowCode(code) {
 			t.Errorf("Unexpected IsAllowCode(%d): %v", code, c.IsAllowCode(code))
@@ -269,3 +431,76 @@ func TestFromModuleConfig(t *testing.T) {
 		t.Errorf("Unexpected IsBlockCode(200): %v", c.IsBlockCode(200))
 	}
 }
+
+func TestConnectionPoolValidation(t *testing.T) {
+	cases := []struct {
+		minIdle, maxIdle int
+		valid            bool
+	}{
+		{0, 0, true},
+		{0, 8, true},
+		{8, 8, true},
+		{9, 8, false},
+		{-1, 8, false},
+		{0, -1, false},
+	}
+	for pos, tt := range cases {
+		_, err := NewModuleConfig(ConnectionPool(tt.minIdle, tt.maxIdle))
+		if (err == nil) != tt.valid {
+			t.Errorf("test %d: ConnectionPool(%d, %d) unexpected error: %v", pos, tt.minIdle, tt.maxIdle, err)
+		}
+	}
+}
+
+func TestSocketValidation(t *testing.T) {
+	cases := []struct {
+		network, address string
+		valid            bool
+	}{
+		{"unix", "/var/run/sigsci.sock", true},
+		{"unix", "sigsci.sock", false},
+		{"tcp", "127.0.0.1:9999", true},
+		{"tcp", "agent.example.com:9999", true},
+		{"tcp", "127.0.0.1", false},
+		{"udp", "127.0.0.1:9999", false},
+	}
+	for pos, tt := range cases {
+		if _, err := NewModuleConfig(Socket(tt.network, tt.address)); (err == nil) != tt.valid {
+			t.Errorf("test %d: Socket(%q, %q) unexpected error: %v", pos, tt.network, tt.address, err)
+		}
+		if _, err := NewModuleConfig(FailoverSocket(tt.network, tt.address)); (err == nil) != tt.valid {
+			t.Errorf("test %d: FailoverSocket(%q, %q) unexpected error: %v", pos, tt.network, tt.address, err)
+		}
+	}
+}
+
+func TestSocketTLS(t *testing.T) {
+	if _, err := NewModuleConfig(SocketTLS("127.0.0.1:9999", nil)); err == nil {
+		t.Errorf("Expected an error for a nil TLS config")
+	}
+	if _, err := NewModuleConfig(SocketTLS("/var/run/sigsci.sock", &tls.Config{})); err == nil {
+		t.Errorf("Expected an error for a non-TCP address")
+	}
+
+	tlsConfig := &tls.Config{ServerName: "agent.example.com"}
+	c, err := NewModuleConfig(SocketTLS("127.0.0.1:9999", tlsConfig))
+	if err != nil {
+		t.Fatalf("Failed to create module config: %s", err)
+	}
+	if c.RPCNetwork() != "tcp" || c.RPCAddress() != "127.0.0.1:9999" || c.RPCTLSConfig() != tlsConfig {
+		t.Errorf("Unexpected TLS socket config: %s %v", c.RPCAddressString(), c.RPCTLSConfig())
+	}
+}
+
+func TestNewAgentTLSConfig(t *testing.T) {
+	if _, err := NewAgentTLSConfig("/nonexistent/ca.pem", "", "", ""); err == nil {
+		t.Errorf("Expected an error for a missing CA file")
+	}
+	config, err := NewAgentTLSConfig("", "", "", "agent.example.com")
+	if err != nil {
+		t.Fatalf("Failed to create TLS config: %s", err)
+	}
+	if config.ServerName != "agent.example.com" || config.RootCAs != nil || len(config.Certificates) != 0 {
+		t.Errorf("Unexpected TLS config: %+v", config)
+	}
+}
@@ -0,0 +1,108 @@
+package sigsci
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// maxResponseDelay limits the delay of Tarpit and SlowResponse responses
+const maxResponseDelay = 30 * time.Second
+
+// slowResponseParts is the number of parts the body of a SlowResponse
+// response is written in
+const slowResponseParts = 10
+
+// endRequest ends the request with the response from the inspector instead
+// of passing it to the handler, in the way given by the response type
+func (m *Module) endRequest(w http.ResponseWriter, req *http.Request, out *RPCMsgOut) {
+	delay := time.Duration(out.DelayMillis) * time.Millisecond
+	switch out.Type {
+	case schema.Tarpit:
+		if !m.wait(req.Context(), delay) {
+			return
+		}
+	case schema.DropConnection:
+		if m.dropConnection(w) {
+			return
+		}
+	case schema.SlowResponse:
+		m.writeSlowResponse(w, req, out, delay)
+		return
+	}
+	writeEndHeader(w, out)
+	w.Write(out.Body)
+}
+
+// writeEndHeader writes the header of the response from the inspector
+func writeEndHeader(w http.ResponseWriter, out *RPCMsgOut) {
+	if err := applyHeaderActions(w.Header(), out.Header); err != nil {
+		log.Printf("ERROR: Received invalid EndRequest header actions from inspector (skipped): %s", err)
+	}
+	w.WriteHeader(out.StatusCode)
+}
+
+// writeSlowResponse writes the response from the inspector with the body
+// in parts spread over the delay, stopping if the client goes away
+func (m *Module) writeSlowResponse(w http.ResponseWriter, req *http.Request, out *RPCMsgOut, delay time.Duration) {
+	writeEndHeader(w, out)
+
+	rc := http.NewResponseController(w)
+	body := out.Body
+	size := (len(body) + slowResponseParts - 1) / slowResponseParts
+	interval := delay
+	if size > 0 {
+		interval = delay / time.Duration((len(body)+size-1)/size)
+	}
+	for len(body) > 0 {
+		part := body[:min(size, len(body))]
+		body = body[len(part):]
+		if _, err := w.Write(part); err != nil {
+			return
+		}
+		rc.Flush()
+		if len(body) > 0 && !m.wait(req.Context(), interval) {
+			return
+		}
+	}
+}
+
+// dropConnection closes the connection without a response, returning false
+// if the connection cannot be taken over from the server (e.g., HTTP/2)
+func (m *Module) dropConnection(w http.ResponseWriter) bool {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		if m.config.Debug() {
+			log.Printf("DEBUG: unable to drop the connection, ending the request instead: %s", err)
+		}
+		return false
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		// Reset the connection rather than closing it gracefully
+		tc.SetLinger(0)
+	}
+	conn.Close()
+	return true
+}
+
+// wait waits for the duration, returning false if the context is done
+// first (e.g., the client went away). The wait is cut short if the module
+// is stopped.
+func (m *Module) wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-m.done:
+	case <-ctx.Done():
+		return false
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package sigsci
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// responseTypeInspector ends every request with a response of a type
+type responseTypeInspector struct {
+	capsInspector
+	typ   int
+	delay time.Duration
+}
+
+func (insp *responseTypeInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.Type = insp.typ
+	out.StatusCode = 429
+	out.Header = []schema.Action{{Code: schema.SetHdr, Args: []string{"Retry-After", "60"}}}
+	out.Body = []byte(strings.Repeat("slow down ", 5))
+	out.DelayMillis = insp.delay.Milliseconds()
+	return nil
+}
+
+func newResponseTypeModule(t *testing.T, typ int, delay time.Duration, caps ...string) *Module {
+	insp := &responseTypeInspector{capsInspector{version: schema.ProtocolVersion, caps: caps}, typ, delay}
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }),
+		CustomInspector(insp, nil, nil),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestEndRequestTypes(t *testing.T) {
+	slowDown := strings.Repeat("slow down ", 5)
+	cases := []struct {
+		typ   int
+		caps  []string
+		delay time.Duration
+		code  int
+		body  string
+	}{
+		{schema.EndRequest, []string{schema.CapEndRequest}, 0, 429, slowDown},
+		{schema.Tarpit, []string{schema.CapTarpit}, 50 * time.Millisecond, 429, slowDown},
+		{schema.SlowResponse, []string{schema.CapSlowResponse}, 50 * time.Millisecond, 429, slowDown},
+		// Falls back to ending the request, as a recorder cannot be hijacked
+		{schema.DropConnection, []string{schema.CapDropConnection}, 0, 429, slowDown},
+		// Ignored without the capability
+		{schema.Tarpit, []string{schema.CapEndRequest}, 50 * time.Millisecond, 200, "ok"},
+		{schema.SlowResponse, nil, 50 * time.Millisecond, 200, "ok"},
+		{schema.DropConnection, nil, 0, 200, "ok"},
+	}
+	for pos, tt := range cases {
+		m := newResponseTypeModule(t, tt.typ, tt.delay, tt.caps...)
+		start := time.Now()
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("test %d: unexpected response %d %q, expected %d %q", pos, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+		if tt.code != 200 && tt.delay > 0 {
+			// The last part of a slow response is written without a delay
+			if d := time.Since(start); d < tt.delay*(slowResponseParts-1)/slowResponseParts {
+				t.Errorf("test %d: unexpected response time %s, expected %s", pos, d, tt.delay)
+			}
+			if w.Header().Get("Retry-After") != "60" {
+				t.Errorf("test %d: unexpected response header %v", pos, w.Header())
+			}
+		}
+	}
+}
+
+func TestTarpitClientGone(t *testing.T) {
+	m := newResponseTypeModule(t, schema.Tarpit, 10*time.Second, schema.CapTarpit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected the tarpit to end with the request, took %s", d)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDropConnection(t *testing.T) {
+	m := newResponseTypeModule(t, schema.DropConnection, 0, schema.CapDropConnection)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		t.Errorf("Expected the connection to be dropped, got %d %q", resp.StatusCode, body)
+	}
+}
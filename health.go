@@ -0,0 +1,113 @@
+package sigsci
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AgentStatus is the health of the agent as seen by the module
+type AgentStatus struct {
+	// Healthy is true if the last call to the agent succeeded
+	Healthy bool
+	// LastSuccess is the time of the last successful call to the agent
+	LastSuccess time.Time
+	// LastError is the time of the last failed call to the agent
+	LastError time.Time
+	// Err is the error from the last failed call to the agent
+	Err error
+}
+
+// agentHealth tracks the results of calls to the agent
+type agentHealth struct {
+	mu     sync.Mutex
+	status AgentStatus
+}
+
+// record records the result of a call to the agent, returning true if
+// the call succeeded after the agent was previously unavailable
+func (h *agentHealth) record(err error) (recovered bool) {
+	now := time.Now()
+	h.mu.Lock()
+	recovered = err == nil && !h.status.Healthy && !h.status.LastError.IsZero()
+	if err != nil {
+		h.status.Healthy = false
+		h.status.LastError = now
+		h.status.Err = err
+	} else {
+		h.status.Healthy = true
+		h.status.LastSuccess = now
+	}
+	h.mu.Unlock()
+	return recovered
+}
+
+// get returns a copy of the current status
+func (h *agentHealth) get() AgentStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Healthy returns true if the last call to the agent succeeded
+func (m *Module) Healthy() bool {
+	return m.health.get().Healthy
+}
+
+// AgentStatus returns the health of the agent as seen by the module
+func (m *Module) AgentStatus() AgentStatus {
+	return m.health.get()
+}
+
+// HealthHandler returns a http.Handler suitable for a readiness endpoint,
+// which responds with a 200 status code if the agent is healthy and a 503
+// status code otherwise
+func (m *Module) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		status := m.AgentStatus()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if status.Err != nil {
+				fmt.Fprintf(w, "agent unhealthy: %s\n", status.Err)
+			} else {
+				fmt.Fprintln(w, "agent unhealthy")
+			}
+			return
+		}
+		fmt.Fprintln(w, "agent healthy")
+	})
+}
+
+// healthCheck periodically probes the agent until the module is stopped
+func (m *Module) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Probe directly, bypassing any circuit breaker, so that the
+		// agent status is current even while the breaker is open
+		in, out := m.moduleInitMsg(), RPCMsgOut{}
+		err := m.inspector.ModuleInit(&in, &out)
+		recovered := m.health.record(err)
+		if err == nil {
+			// Refresh the capabilities and any configuration from the agent
+			m.negotiate(&out)
+			if recovered {
+				// The probe registered the module with the recovered
+				// agent, so send any reports spooled while it was down
+				go m.replaySpool()
+			}
+		} else if m.config.Debug() {
+			log.Printf("DEBUG: health check 'RPC.ModuleInit' call failed: %s", err)
+		}
+	}
+}
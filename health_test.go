@@ -0,0 +1,133 @@
+package sigsci
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// toggleInspector is a test inspector where calls can be made to fail
+type toggleInspector struct {
+	testInspector
+	fail  int32
+	inits int32 // successful ModuleInit calls
+}
+
+func (insp *toggleInspector) setFail(fail bool) {
+	v := int32(0)
+	if fail {
+		v = 1
+	}
+	atomic.StoreInt32(&insp.fail, v)
+}
+
+func (insp *toggleInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
+	if atomic.LoadInt32(&insp.fail) != 0 {
+		return errTestFailure
+	}
+	atomic.AddInt32(&insp.inits, 1)
+	return insp.testInspector.ModuleInit(in, out)
+}
+
+func (insp *toggleInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	if atomic.LoadInt32(&insp.fail) != 0 {
+		return errTestFailure
+	}
+	return insp.testInspector.PreRequest(in, out)
+}
+
+func TestModuleHealth(t *testing.T) {
+	insp := &toggleInspector{testInspector: testInspector{resp: 200}}
+	insp.setFail(true)
+	m, err := NewModule(http.NotFoundHandler(), CustomInspector(insp, nil, nil))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+
+	status := m.AgentStatus()
+	if m.Healthy() || status.Healthy || status.Err != errTestFailure || status.LastError.IsZero() || !status.LastSuccess.IsZero() {
+		t.Fatalf("Unexpected agent status after failed ModuleInit: %+v", status)
+	}
+	w := httptest.NewRecorder()
+	m.HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), errTestFailure.Error()) {
+		t.Errorf("Unexpected health response: %d %q", w.Code, w.Body.String())
+	}
+
+	// Traffic updates the status
+	insp.setFail(false)
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+	status = m.AgentStatus()
+	if !m.Healthy() || status.LastSuccess.IsZero() {
+		t.Fatalf("Unexpected agent status after successful PreRequest: %+v", status)
+	}
+	w = httptest.NewRecorder()
+	m.HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected health response: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestModuleHealthCheck(t *testing.T) {
+	insp := &toggleInspector{testInspector: testInspector{resp: 200}}
+	m, err := NewModule(http.NotFoundHandler(),
+		CustomInspector(insp, nil, nil),
+		HealthCheck(5*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	if !m.Healthy() {
+		t.Fatalf("Expected module to be healthy")
+	}
+
+	insp.setFail(true)
+	waitFor(t, func() bool { return !m.Healthy() })
+	insp.setFail(false)
+	waitFor(t, m.Healthy)
+}
+
+func TestModuleRegister(t *testing.T) {
+	insp := &toggleInspector{testInspector: testInspector{resp: 200}}
+	insp.setFail(true)
+	m, err := NewModule(http.NotFoundHandler(),
+		CustomInspector(insp, nil, nil),
+		RegisterBackoff(time.Millisecond, 5*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+
+	// The agent starting after the module
+	insp.setFail(false)
+	waitFor(t, func() bool { return atomic.LoadInt32(&insp.inits) == 1 })
+
+	// The agent restarting
+	insp.setFail(true)
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+	insp.setFail(false)
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+	waitFor(t, func() bool { return atomic.LoadInt32(&insp.inits) == 2 })
+
+	// No registration while the agent stays available
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&insp.inits); n != 2 {
+		t.Errorf("Unexpected number of ModuleInit calls=%d, expected=2", n)
+	}
+}
+
+// waitFor waits for the condition to be true, failing the test on timeout
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
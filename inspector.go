@@ -1,6 +1,10 @@
 package sigsci
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"net/http"
+)
 
 // InspectorInitFunc is called to decide if the request should be inspected
 // Return true if inspection should occur for the request or false if
@@ -18,6 +22,12 @@ type Inspector interface {
 	// sent to the collector so that the agent shows up initialized without having
 	// to wait for data to be sent through the inspector. This should only be called
 	// once when the app/module starts.
+	//
+	// The reply enables the capabilities offered in the message (see
+	// schema.ProtocolVersion). A reply without a ProtocolVersion is from an
+	// agent that predates the capability exchange, so only enables EndRequest,
+	// RespActions and BatchRequest, and the features of any other capabilities
+	// are not used.
 	ModuleInit(*RPCMsgIn, *RPCMsgOut) error
 	// PreRequest is called before the request is processed by the app. The results
 	// should be analyzed for any anomalies or blocking conditions. In addition, any
@@ -37,3 +47,102 @@ type Inspector interface {
 	// headers, etc.).
 	UpdateRequest(*RPCMsgIn2, *RPCMsgOut) error
 }
+
+// BatchInspector is an Inspector that can also send a batch of reports
+// in a single call
+type BatchInspector interface {
+	Inspector
+
+	// BatchRequest is called with a batch of reports that would otherwise
+	// each be sent with a `PostRequest` or `UpdateRequest` call. If the
+	// inspection engine does not support batches, then the reports should
+	// be sent individually instead.
+	BatchRequest(*RPCMsgBatch, *RPCMsgOut) error
+}
+
+// ContextInspector is an Inspector that also accepts a context for each
+// call. The call should be abandoned with the context error as soon as the
+// context is done, and any context deadline should limit the call.
+type ContextInspector interface {
+	Inspector
+
+	// ModuleInit with a context, see Inspector
+	ModuleInitContext(context.Context, *RPCMsgIn, *RPCMsgOut) error
+	// PreRequest with a context, see Inspector
+	PreRequestContext(context.Context, *RPCMsgIn, *RPCMsgOut) error
+	// PostRequest with a context, see Inspector
+	PostRequestContext(context.Context, *RPCMsgIn, *RPCMsgOut) error
+	// UpdateRequest with a context, see Inspector
+	UpdateRequestContext(context.Context, *RPCMsgIn2, *RPCMsgOut) error
+}
+
+// NewContextInspector returns a ContextInspector for the inspector. If the
+// inspector does not already implement ContextInspector, then it is
+// adapted so that calls return when the context is done, even though the
+// underlying call continues in the background until it completes.
+func NewContextInspector(insp Inspector) ContextInspector {
+	if ci, ok := insp.(ContextInspector); ok {
+		return ci
+	}
+	return contextInspector{insp}
+}
+
+// contextInspector adapts an Inspector to a ContextInspector
+type contextInspector struct {
+	Inspector
+}
+
+func (ci contextInspector) ModuleInitContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	return callContext(ctx, out, func(out *RPCMsgOut) error { return ci.ModuleInit(in, out) })
+}
+
+func (ci contextInspector) PreRequestContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	return callContext(ctx, out, func(out *RPCMsgOut) error { return ci.PreRequest(in, out) })
+}
+
+func (ci contextInspector) PostRequestContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	return callContext(ctx, out, func(out *RPCMsgOut) error { return ci.PostRequest(in, out) })
+}
+
+func (ci contextInspector) UpdateRequestContext(ctx context.Context, in *RPCMsgIn2, out *RPCMsgOut) error {
+	return callContext(ctx, out, func(out *RPCMsgOut) error { return ci.UpdateRequest(in, out) })
+}
+
+// callContext calls fn, returning early if the context is done. The call
+// uses a private output so that a late result does not race with the
+// caller using the output.
+func callContext(ctx context.Context, out *RPCMsgOut, fn func(*RPCMsgOut) error) error {
+	if ctx.Done() == nil {
+		// Cannot be cancelled
+		return fn(out)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	type result struct {
+		out RPCMsgOut
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		r.err = fn(&r.out)
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if r.err == nil {
+			*out = r.out
+		}
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isContextError returns true if the error is due to a context being done
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
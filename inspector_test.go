@@ -0,0 +1,100 @@
+package sigsci
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowInspector is a custom inspector that takes a while to respond
+type slowInspector struct {
+	testInspector
+	delay time.Duration
+}
+
+func (insp *slowInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	time.Sleep(insp.delay)
+	return insp.testInspector.PreRequest(in, out)
+}
+
+func TestNewContextInspector(t *testing.T) {
+	ri := &RPCInspector{}
+	if ci := NewContextInspector(ri); ci != ContextInspector(ri) {
+		t.Errorf("Expected the RPCInspector to be used as is, got %T", ci)
+	}
+
+	ci := NewContextInspector(&slowInspector{testInspector: testInspector{resp: 406}, delay: 50 * time.Millisecond})
+
+	// Without cancellation
+	out := RPCMsgOut{}
+	if err := ci.PreRequestContext(context.Background(), &RPCMsgIn{}, &out); err != nil {
+		t.Fatalf("PreRequest failed: %s", err)
+	}
+	if out.WAFResponse != 406 {
+		t.Errorf("Unexpected WAFResponse=%d", out.WAFResponse)
+	}
+
+	// The call returns once the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	out = RPCMsgOut{}
+	err := ci.PreRequestContext(ctx, &RPCMsgIn{}, &out)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The late result is not written to the output
+	time.Sleep(100 * time.Millisecond)
+	if out.WAFResponse != 0 {
+		t.Errorf("Output was modified after the call returned: WAFResponse=%d", out.WAFResponse)
+	}
+
+	// Already done
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := ci.ModuleInitContext(ctx, &RPCMsgIn{}, &RPCMsgOut{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestModuleContextDone(t *testing.T) {
+	called := false
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			called = true
+			w.Write([]byte("ok"))
+		}),
+		CustomInspector(&slowInspector{testInspector: testInspector{resp: 406}, delay: 50 * time.Millisecond}, nil, nil),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	// The client goes away before the inspector blocks the request
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	req := httptest.NewRequest("POST", "/", strings.NewReader("<script>"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req.WithContext(ctx))
+	if called {
+		t.Errorf("The handler was called without an inspection")
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	// The request deadline passing (e.g., http.TimeoutHandler) fails open
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if !called || w.Code != 200 || w.Body.String() != "ok" {
+		t.Errorf("Expected to fail open, got %d %q", w.Code, w.Body.String())
+	}
+}
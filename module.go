@@ -2,6 +2,8 @@ package sigsci
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,6 +21,8 @@ import (
 type RPCMsgIn = schema.RPCMsgIn
 type RPCMsgIn2 = schema.RPCMsgIn2
 type RPCMsgOut = schema.RPCMsgOut
+type RPCMsgBatch = schema.RPCMsgBatch
+type RPCReportOut = schema.RPCReportOut
 
 // Module is an http.Handler that wraps an existing handler with
 // data collection and sends it to the Signal Sciences Agent for
@@ -27,8 +31,25 @@ type Module struct {
 	config    *ModuleConfig
 	handler   http.Handler
 	inspector Inspector
+	ctxInsp   ContextInspector
 	inspInit  InspectorInitFunc
 	inspFini  InspectorFiniFunc
+	breaker   *circuitBreaker
+	reports   *reporter      // nil if using a goroutine per report
+	batcher   *reportBatcher // nil if not batching reports
+	spool     *reportSpool   // nil if not spooling failed reports
+	health    agentHealth
+	pooled    bool          // messages are reused once sent
+	done      chan struct{} // closed when the module is stopped
+
+	caps        uint32 // capabilities enabled by the agent
+	registering int32  // set while a registration is in progress
+	replaying   int32  // set while the spool is being replayed
+
+	stopMu   sync.RWMutex
+	stopped  bool // no new inspections once stopped
+	stopOnce sync.Once
+	pending  sync.WaitGroup // pending inspections and background reports
 }
 
 // NewModule wraps an existing http.Handler with one that extracts data and
@@ -42,12 +63,14 @@ func NewModule(h http.Handler, options ...ModuleConfigOption) (*Module, error) {
 	}
 
 	// The following are the defaults, overridden by passing in functional options
-	m := Module{
+	m := &Module{
 		handler:   h,
 		config:    config,
 		inspector: config.Inspector(),
 		inspInit:  config.InspectorInit(),
 		inspFini:  config.InspectorFini(),
+		caps:      uint32(legacyCapabilities),
+		done:      make(chan struct{}),
 	}
 
 	// By default, use an RPC based inspector if not configured externally
@@ -57,27 +80,76 @@ func NewModule(h http.Handler, options ...ModuleConfigOption) (*Module, error) {
 			Address: m.config.RPCAddress(),
 			Timeout: m.config.Timeout(),
 			Debug:   m.config.Debug(),
+
+			DialTimeout:   m.config.DialTimeout(),
+			ReportTimeout: m.config.ReportTimeout(),
+
+			Endpoints: m.config.RPCEndpoints(),
+			Balance:   m.config.LoadBalance(),
+			TLSConfig: m.config.RPCTLSConfig(),
+
+			MinIdleConns: m.config.MinIdleConnections(),
+			MaxIdleConns: m.config.MaxIdleConnections(),
+			IdleTimeout:  m.config.IdleConnectionTimeout(),
+
+			MultiplexConns: m.config.MultiplexConnections(),
+		}
+
+		// The module's own inspector does not keep the messages it is
+		// given, so they can be reused
+		m.pooled = true
+	}
+
+	m.ctxInsp = NewContextInspector(m.inspector)
+
+	if m.config.CircuitBreakerFailures() > 0 || m.config.CircuitBreakerErrorRate() > 0 {
+		m.breaker = newCircuitBreaker(
+			m.config.CircuitBreakerFailures(),
+			m.config.CircuitBreakerErrorRate(),
+			m.config.CircuitBreakerWindow(),
+			m.config.CircuitBreakerCooldown(),
+			m.config.CircuitBreakerProbes(),
+		)
+	}
+
+	if dir := m.config.SpoolDir(); dir != "" {
+		if m.spool, err = openSpool(dir, m.config.SpoolMaxBytes()); err != nil {
+			return nil, err
 		}
 	}
 
 	// Call ModuleInit to initialize the module data, so that the agent is
 	// registered on module creation
-	now := time.Now()
-	in := RPCMsgIn{
-		ModuleVersion: m.config.ModuleIdentifier(),
-		ServerVersion: m.config.ServerIdentifier(),
-		ServerFlavor:  m.config.ServerFlavor(),
-		Timestamp:     now.Unix(),
-		NowMillis:     now.UnixNano() / 1e6,
-	}
-	out := RPCMsgOut{}
-	if err := m.inspector.ModuleInit(&in, &out); err != nil {
+	in, out := m.moduleInitMsg(), RPCMsgOut{}
+	if err := m.callInspector(func() error { return m.inspector.ModuleInit(&in, &out) }); err != nil {
 		if m.config.Debug() {
 			log.Println("Error in moduleinit to inspector: ", err.Error())
 		}
+		// Keep trying in the background in case the agent starts after the app
+		go m.register()
+	} else {
+		m.negotiate(&out)
+		// Send any reports spooled by a previous run
+		go m.replaySpool()
 	}
 
-	return &m, nil
+	if workers := m.config.ReportWorkers(); workers > 0 {
+		m.reports = newReporter(workers, m.config.ReportQueueSize(), m.config.ReportDropPolicy())
+	}
+
+	if size := m.config.ReportBatchSize(); size > 0 {
+		m.batcher = &reportBatcher{
+			size:   size,
+			window: m.config.ReportBatchWindow(),
+			send:   m.reportBatch,
+		}
+	}
+
+	if interval := m.config.HealthCheckInterval(); interval > 0 {
+		go m.healthCheck(interval)
+	}
+
+	return m, nil
 }
 
 // Version returns a SemVer version string
@@ -88,7 +160,6 @@ func Version() string {
 // ServeHTTP satisfies the http.Handler interface
 func (m *Module) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	start := time.Now()
-	finiwg := sync.WaitGroup{}
 
 	// Use the inspector init/fini functions if available
 	if m.inspInit != nil && !m.inspInit(req) {
@@ -96,42 +167,57 @@ func (m *Module) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		m.handler.ServeHTTP(w, req)
 		return
 	}
+	if !m.begin() {
+		// The module is shutting down, so no new inspections
+		m.handler.ServeHTTP(w, req)
+		return
+	}
+	var report, fini func()
 	if m.inspFini != nil {
-		defer func() {
-			// Delay the finalizer call until inspection (any pending Post
-			// or Update call) is complete
-			go func() {
-				finiwg.Wait()
-				m.inspFini(req)
-			}()
-		}()
+		fini = func() { m.inspFini(req) }
 	}
+	defer func() {
+		// Make any Post or Update call in the background, delaying the
+		// finalizer call until it is complete
+		m.report(report, fini)
+		m.pending.Done()
+	}()
 
 	if m.config.Debug() {
 		log.Printf("DEBUG: calling 'RPC.PreRequest' for inspection: method=%s host=%s url=%s", req.Method, req.Host, req.URL)
 	}
-	inspin2, out, err := m.inspectorPreRequest(req)
+	inspin, out, err := m.inspectorPreRequest(req)
+	var perr *ProtocolError
+	if err != nil && m.config.StrictProtocol() && errors.As(err, &perr) {
+		m.releaseMsgIn(inspin)
+		http.Error(w, perr.Error(), http.StatusBadGateway)
+		return
+	}
+	if errors.Is(err, context.Canceled) && errors.Is(req.Context().Err(), context.Canceled) {
+		// The client went away during the inspection, so there is no
+		// one to respond to, and the request must not reach the handler
+		// uninspected. A request deadline passing (e.g., set by
+		// http.TimeoutHandler) fails open as any other error.
+		if m.config.Debug() {
+			log.Printf("DEBUG: 'RPC.PreRequest' call abandoned (%s %s): %s", req.Method, req.URL, err)
+		}
+		m.releaseMsgIn(inspin)
+		return
+	}
 	if err != nil {
 		// Fail open
 		if m.config.Debug() {
 			log.Printf("ERROR: 'RPC.PreRequest' call failed (failing open): %s", err.Error())
 		}
+		m.releaseMsgIn(inspin)
 		m.handler.ServeHTTP(w, req)
 		return
 	}
 
 	switch out.Type {
-	case schema.EndRequest:
-		for _, h := range out.Header {
-			switch h.Code {
-			case schema.AddHdr:
-				w.Header().Add(h.Args[0], h.Args[1])
-			case schema.SetHdr:
-				w.Header().Set(h.Args[0], h.Args[1])
-			}
-		}
-		w.WriteHeader(out.StatusCode)
-		w.Write(out.Body)
+	case schema.EndRequest, schema.Tarpit, schema.DropConnection, schema.SlowResponse:
+		m.releaseMsgIn(inspin)
+		m.endRequest(w, req, &out)
 		return
 	}
 
@@ -140,8 +226,8 @@ func (m *Module) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	wafresponse := out.WAFResponse
 	switch {
 	case m.config.IsAllowCode(int(wafresponse)):
-		// Continue with normal request
-		m.handler.ServeHTTP(rw, req)
+		// Continue with normal request, as changed by any request actions
+		m.handler.ServeHTTP(rw, m.handlerRequest(req, &out))
 	case m.config.IsBlockCode(int(wafresponse)):
 		status := int(wafresponse)
 
@@ -157,6 +243,12 @@ func (m *Module) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		// Block
 		http.Error(rw, fmt.Sprintf("%d %s\n", status, http.StatusText(status)), status)
 	default:
+		if m.config.StrictProtocol() {
+			perr := &ProtocolError{Method: "RPC.PreRequest", Err: fmt.Errorf("invalid WAFResponse %d", wafresponse)}
+			log.Printf("ERROR: %s", perr)
+			http.Error(rw, perr.Error(), http.StatusBadGateway)
+			break
+		}
 		log.Printf("ERROR: Received invalid response code from inspector (failing open): %d", wafresponse)
 		// Continue with normal request
 		m.handler.ServeHTTP(rw, req)
@@ -166,38 +258,59 @@ func (m *Module) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	code := rw.StatusCode()
 	size := rw.BytesWritten()
 
-	if len(inspin2.RequestID) > 0 {
+	if len(out.RequestID) > 0 {
 		// Do the UpdateRequest inspection in the background while the foreground hurries the response back to the end-user.
+		m.releaseMsgIn(inspin)
+		inspin2 := m.newMsgIn2()
+		inspin2.RequestID = out.RequestID
 		inspin2.ResponseCode = int32(code)
 		inspin2.ResponseSize = size
 		inspin2.ResponseMillis = int64(duration / time.Millisecond)
-		inspin2.HeadersOut = convertHeaders(rw.Header())
+		inspin2.HeadersOut = appendHeaders(inspin2.HeadersOut, rw.Header())
 		if m.config.Debug() {
 			log.Printf("DEBUG: calling 'RPC.UpdateRequest' due to returned requestid=%s: method=%s host=%s url=%s code=%d size=%d duration=%s", inspin2.RequestID, req.Method, req.Host, req.URL, code, size, duration)
 		}
-		finiwg.Add(1) // Inspection finializer will wait for this goroutine
-		go func() {
-			defer finiwg.Done()
+		if m.batcher != nil {
+			// Sent as part of a batch, finalizing once the batch is sent.
+			// The batch shares the headers, so the message is not reused.
+			m.batcher.add(nil, inspin2, m.track(fini))
+			fini = nil
+			return
+		}
+		report = func() {
 			if err := m.inspectorUpdateRequest(inspin2); err != nil && m.config.Debug() {
 				log.Printf("ERROR: 'RPC.UpdateRequest' call failed: %s", err.Error())
 			}
-		}()
+			m.releaseMsgIn2(inspin2)
+		}
 	} else if code >= 300 || size >= m.config.AnomalySize() || duration >= m.config.AnomalyDuration() {
 		// Do the PostRequest inspection in the background while the foreground hurries the response back to the end-user.
 		if m.config.Debug() {
 			log.Printf("DEBUG: calling 'RPC.PostRequest' due to anomaly: method=%s host=%s url=%s code=%d size=%d duration=%s", req.Method, req.Host, req.URL, code, size, duration)
 		}
-		inspin := NewRPCMsgIn(m.config, req, nil, code, size, duration)
+		if !m.pooled {
+			// A custom inspector may have kept the PreRequest message
+			inspin = &RPCMsgIn{}
+		}
+		setRPCMsgIn(inspin, m.config, req, "", code, size, duration)
 		inspin.WAFResponse = wafresponse
-		inspin.HeadersOut = convertHeaders(rw.Header())
-
-		finiwg.Add(1) // Inspection finializer will wait for this goroutine
-		go func() {
-			defer finiwg.Done()
+		inspin.HeadersOut = appendHeaders(inspin.HeadersOut, rw.Header())
+
+		if m.batcher != nil {
+			// Sent as part of a batch, finalizing once the batch is sent.
+			// The batch shares the headers, so the message is not reused.
+			m.batcher.add(inspin, nil, m.track(fini))
+			fini = nil
+			return
+		}
+		report = func() {
 			if err := m.inspectorPostRequest(inspin); err != nil && m.config.Debug() {
 				log.Printf("ERROR: 'RPC.PostRequest' call failed: %s", err.Error())
 			}
-		}()
+			m.releaseMsgIn(inspin)
+		}
+	} else {
+		m.releaseMsgIn(inspin)
 	}
 }
 
@@ -221,8 +334,45 @@ func (m *Module) ModuleConfig() *ModuleConfig {
 	return m.config
 }
 
+// BreakerState returns the state of the circuit breaker around the
+// inspector, which is always BreakerClosed if not configured
+func (m *Module) BreakerState() BreakerState {
+	return m.breaker.State()
+}
+
+// moduleInitMsg returns the message identifying the module to the agent
+func (m *Module) moduleInitMsg() RPCMsgIn {
+	now := time.Now()
+	return RPCMsgIn{
+		ModuleVersion:   m.config.ModuleIdentifier(),
+		ServerVersion:   m.config.ServerIdentifier(),
+		ServerFlavor:    m.config.ServerFlavor(),
+		Timestamp:       now.Unix(),
+		NowMillis:       now.UnixNano() / 1e6,
+		ProtocolVersion: schema.ProtocolVersion,
+		Capabilities:    m.supported().names(),
+	}
+}
+
+// callInspector makes a call to the inspector guarded by any circuit
+// breaker, tracking the result in the agent status. Calls abandoned
+// because the request context is done say nothing about the agent, so
+// are not tracked.
+func (m *Module) callInspector(fn func() error) error {
+	err := m.breaker.do(fn)
+	if err == ErrBreakerOpen || isContextError(err) {
+		return err
+	}
+	if m.health.record(err) {
+		// The agent is reachable again (e.g., it restarted), so make
+		// sure it knows about this module
+		go m.register()
+	}
+	return err
+}
+
 // inspectorPreRequest reads the body if required and makes a prerequest call to the inspector
-func (m *Module) inspectorPreRequest(req *http.Request) (inspin2 RPCMsgIn2, out RPCMsgOut, err error) {
+func (m *Module) inspectorPreRequest(req *http.Request) (inspin *RPCMsgIn, out RPCMsgOut, err error) {
 	// Create message to the inspector from the input request
 	// see if we can read-in the post body
 
@@ -233,28 +383,43 @@ func (m *Module) inspectorPreRequest(req *http.Request) (inspin2 RPCMsgIn2, out
 		// It's possible that it is an error event
 		// but not sure what it is. Likely
 		// the client disconnected.
-		reqbody, _ = io.ReadAll(req.Body)
+		reqbody = readBody(req)
 		req.Body.Close()
 
 		// make a new reader so the next handler
 		// can still read the post normally as if
 		// nothing happened
-		req.Body = io.NopCloser(bytes.NewBuffer(reqbody))
+		body := &bodyReader{}
+		body.Reset(reqbody)
+		req.Body = body
 	}
 
-	inspin := NewRPCMsgIn(m.config, req, reqbody, -1, -1, 0)
+	// The body is only read from here on, so is not copied
+	inspin = m.newMsgIn()
+	setRPCMsgIn(inspin, m.config, req, bytesToString(reqbody), -1, -1, 0)
 
 	if m.config.Debug() {
 		log.Printf("DEBUG: Making PreRequest call to inspector: %s %s", inspin.Method, inspin.URI)
 	}
 
-	err = m.inspector.PreRequest(inspin, &out)
+	// The call is abandoned if the client goes away or the request
+	// deadline passes before the inspector responds
+	ctx := req.Context()
+	err = m.callInspector(func() error { return m.ctxInsp.PreRequestContext(ctx, inspin, &out) })
 	if err != nil {
 		if m.config.Debug() {
 			log.Printf("DEBUG: PreRequest call error (%s %s): %s", inspin.Method, inspin.URI, err)
 		}
 		return
 	}
+	m.applyCapabilities(&out)
+	if err = m.checkOut("RPC.PreRequest", &out); err != nil {
+		if m.config.StrictProtocol() {
+			return
+		}
+		// Apply the rest of the response
+		err = nil
+	}
 
 	if out.RequestID != "" {
 		req.Header.Set("X-Sigsci-Requestid", out.RequestID)
@@ -277,13 +442,6 @@ func (m *Module) inspectorPreRequest(req *http.Request) (inspin2 RPCMsgIn2, out
 		}
 	}
 
-	inspin2 = RPCMsgIn2{
-		RequestID:      out.RequestID,
-		ResponseCode:   -1,
-		ResponseMillis: -1,
-		ResponseSize:   -1,
-	}
-
 	if m.config.Debug() {
 		tags := req.Header.Get("X-Sigsci-Tags")
 		log.Printf("DEBUG: PreRequest call (%s %s): %d RequestID=%s Tags=%v", inspin.Method, inspin.URI, wafresponse, out.RequestID, tags)
@@ -300,41 +458,111 @@ func (m *Module) inspectorPostRequest(inspin *RPCMsgIn) error {
 		log.Printf("DEBUG: Making PostRequest call to inspector: %s %s", inspin.Method, inspin.URI)
 	}
 
-	// NOTE: Currently the output argument is not used
-	err := m.inspector.PostRequest(inspin, &RPCMsgOut{})
+	var out RPCMsgOut
+	err := m.callInspector(func() error { return m.inspector.PostRequest(inspin, &out) })
 	if err != nil {
 		if m.config.Debug() {
 			log.Printf("DEBUG: PostRequest call error (%s %s): %s", inspin.Method, inspin.URI, err)
 		}
+		m.spoolReport(spoolPostRequest, inspin, err)
+		return err
 	}
 
-	return err
+	return m.reportResponse("RPC.PostRequest", inspin, nil, &out)
 }
 
 // inspectorUpdateRequest makes an updaterequest call to the inspector
-func (m *Module) inspectorUpdateRequest(inspin RPCMsgIn2) error {
+func (m *Module) inspectorUpdateRequest(inspin *RPCMsgIn2) error {
 	if m.config.Debug() {
 		log.Printf("DEBUG: Making UpdateRequest call to inspector: RequestID=%s", inspin.RequestID)
 	}
 
-	// NOTE: Currently the output argument is not used
-	err := m.inspector.UpdateRequest(&inspin, &RPCMsgOut{})
+	var out RPCMsgOut
+	err := m.callInspector(func() error { return m.inspector.UpdateRequest(inspin, &out) })
 	if err != nil {
 		if m.config.Debug() {
 			log.Printf("DEBUG: UpdateRequest call error (RequestID=%s): %s", inspin.RequestID, err)
 		}
+		m.spoolReport(spoolUpdateRequest, inspin, err)
+		return err
 	}
 
-	return err
+	return m.reportResponse("RPC.UpdateRequest", nil, inspin, &out)
+}
+
+// reportResponse passes the agent's response to a report to the handler,
+// if there is one and the agent has enabled responses to reports. An
+// invalid response is only returned as an error in strict mode, and
+// otherwise the rest of the response is passed.
+func (m *Module) reportResponse(method string, in *RPCMsgIn, in2 *RPCMsgIn2, out *RPCMsgOut) error {
+	fn := m.config.ReportResponseHandler()
+	if fn == nil || !out.HasReportResponse() || !m.capabilities().has(capReportResponse) {
+		return nil
+	}
+	if err := m.checkOut(method, out); err != nil && m.config.StrictProtocol() {
+		return err
+	}
+	if !out.HasReportResponse() {
+		return nil
+	}
+	if m.config.Debug() {
+		log.Printf("DEBUG: report response: %d RequestHeaders=%v", out.WAFResponse, out.RequestHeaders)
+	}
+	fn(in, in2, out)
+	return nil
+}
+
+// inspectorBatchRequest sends a batch of reports to the inspector, using
+// individual postrequest and updaterequest calls if batches are not
+// supported by the inspector or not enabled by the agent
+func (m *Module) inspectorBatchRequest(batch *RPCMsgBatch) {
+	if bi, ok := m.inspector.(BatchInspector); ok && m.capabilities().has(capBatchRequest) {
+		if m.config.Debug() {
+			log.Printf("DEBUG: Making BatchRequest call to inspector: %d PostRequest and %d UpdateRequest reports", len(batch.PostRequests), len(batch.UpdateRequests))
+		}
+		err := m.callInspector(func() error { return bi.BatchRequest(batch, &RPCMsgOut{}) })
+		if err != nil {
+			if m.config.Debug() {
+				log.Printf("ERROR: 'RPC.BatchRequest' call failed: %s", err.Error())
+			}
+			for i := range batch.PostRequests {
+				m.spoolReport(spoolPostRequest, &batch.PostRequests[i], err)
+			}
+			for i := range batch.UpdateRequests {
+				m.spoolReport(spoolUpdateRequest, &batch.UpdateRequests[i], err)
+			}
+		}
+		return
+	}
+
+	for i := range batch.PostRequests {
+		if err := m.inspectorPostRequest(&batch.PostRequests[i]); err != nil && m.config.Debug() {
+			log.Printf("ERROR: 'RPC.PostRequest' call failed: %s", err.Error())
+		}
+	}
+	for i := range batch.UpdateRequests {
+		if err := m.inspectorUpdateRequest(&batch.UpdateRequests[i]); err != nil && m.config.Debug() {
+			log.Printf("ERROR: 'RPC.UpdateRequest' call failed: %s", err.Error())
+		}
+	}
 }
 
 // NewRPCMsgIn creates a message from a go http.Request object
 // End-users of the golang module never need to use this
 // directly and it is only exposed for performance testing
 func NewRPCMsgIn(mcfg *ModuleConfig, r *http.Request, postbody []byte, code int, size int64, dur time.Duration) *RPCMsgIn {
+	msgIn := &RPCMsgIn{}
+	setRPCMsgIn(msgIn, mcfg, r, string(postbody), code, size, dur)
+	return msgIn
+}
+
+// setRPCMsgIn sets the message from a go http.Request object, reusing the
+// header slices of the message
+func setRPCMsgIn(msgIn *RPCMsgIn, mcfg *ModuleConfig, r *http.Request, postbody string, code int, size int64, dur time.Duration) {
 	now := time.Now()
+	headers := msgIn.HeadersIn[:0]
 
-	msgIn := RPCMsgIn{
+	*msgIn = RPCMsgIn{
 		ModuleVersion:  mcfg.ModuleIdentifier(),
 		ServerVersion:  mcfg.ServerIdentifier(),
 		ServerFlavor:   mcfg.ServerFlavor(),
@@ -348,7 +576,8 @@ func NewRPCMsgIn(mcfg *ModuleConfig, r *http.Request, postbody []byte, code int,
 		ResponseCode:   int32(code),
 		ResponseMillis: dur.Milliseconds(),
 		ResponseSize:   size,
-		PostBody:       string(postbody),
+		PostBody:       postbody,
+		HeadersOut:     msgIn.HeadersOut[:0],
 	}
 
 	if r.TLS != nil {
@@ -361,12 +590,13 @@ func NewRPCMsgIn(mcfg *ModuleConfig, r *http.Request, postbody []byte, code int,
 	}
 
 	if hdrs := mcfg.RawHeaderExtractor(); hdrs != nil {
-		msgIn.HeadersIn = hdrs(r)
-	}
-	if msgIn.HeadersIn == nil {
-		msgIn.HeadersIn = requestHeader(r)
+		if extracted := hdrs(r); extracted != nil {
+			// Copied, as the message headers may be reused
+			msgIn.HeadersIn = append(headers, extracted...)
+			return
+		}
 	}
-	return &msgIn
+	msgIn.HeadersIn = appendRequestHeader(headers, r)
 }
 
 // stripPort removes any port from an address (e.g., the client port from the RemoteAddr)
@@ -422,6 +652,27 @@ func shouldReadBody(req *http.Request, m *Module) bool {
 	return false
 }
 
+// readBody reads all of the request body, in a single allocation if the
+// length is known
+func readBody(req *http.Request) []byte {
+	if req.ContentLength <= 0 {
+		body, _ := io.ReadAll(req.Body)
+		return body
+	}
+	body := make([]byte, req.ContentLength)
+	n, _ := io.ReadFull(req.Body, body)
+	return body[:n]
+}
+
+// bodyReader replaces a request body that has been read
+type bodyReader struct {
+	bytes.Reader
+}
+
+func (*bodyReader) Close() error {
+	return nil
+}
+
 // inspectableContentType returns true for an inspectable content type
 func inspectableContentType(s string) bool {
 	s = strings.ToLower(s)
@@ -462,7 +713,14 @@ func inspectableContentType(s string) bool {
 
 // requestHeader returns request headers with host header
 func requestHeader(r *http.Request) [][2]string {
-	out := make([][2]string, 0, len(r.Header)+1)
+	return appendRequestHeader(nil, r)
+}
+
+// appends the request headers (including the Host) to out
+func appendRequestHeader(out [][2]string, r *http.Request) [][2]string {
+	if cap(out) == 0 {
+		out = make([][2]string, 0, len(r.Header)+1)
+	}
 	// golang removes Host header from req.Header map and
 	// promotes it to r.Host field. Add it back as the first header.
 	if len(r.Host) > 0 {
@@ -478,8 +736,14 @@ func requestHeader(r *http.Request) [][2]string {
 
 // converts a http.Header map to a [][2]string
 func convertHeaders(h http.Header) [][2]string {
-	// get headers
-	out := make([][2]string, 0, len(h)+1)
+	return appendHeaders(nil, h)
+}
+
+// appends a http.Header map to out
+func appendHeaders(out [][2]string, h http.Header) [][2]string {
+	if cap(out) == 0 {
+		out = make([][2]string, 0, len(h)+1)
+	}
 
 	for key, values := range h {
 		for _, value := range values {
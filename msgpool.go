@@ -0,0 +1,78 @@
+package sigsci
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Messages are reused across requests to reduce allocations, keeping the
+// header slices for reuse. This is only done when the module uses its own
+// RPCInspector, which is done with a message once the call returns,
+// whereas a custom inspector may keep the messages it is given.
+
+// maxPooledHeaders limits the header slices kept for reuse, so that an
+// unusually large request does not pin a large slice
+const maxPooledHeaders = 256
+
+var (
+	msgInPool  = sync.Pool{New: func() interface{} { return new(RPCMsgIn) }}
+	msgIn2Pool = sync.Pool{New: func() interface{} { return new(RPCMsgIn2) }}
+)
+
+// newMsgIn returns an empty message, reused if messages are pooled
+func (m *Module) newMsgIn() *RPCMsgIn {
+	if !m.pooled {
+		return &RPCMsgIn{}
+	}
+	return msgInPool.Get().(*RPCMsgIn)
+}
+
+// releaseMsgIn makes the message available for reuse if messages are
+// pooled. The message must not be used afterwards.
+func (m *Module) releaseMsgIn(in *RPCMsgIn) {
+	if !m.pooled || in == nil {
+		return
+	}
+	*in = RPCMsgIn{
+		HeadersIn:  reuseHeaders(in.HeadersIn),
+		HeadersOut: reuseHeaders(in.HeadersOut),
+	}
+	msgInPool.Put(in)
+}
+
+// newMsgIn2 returns an empty message, reused if messages are pooled
+func (m *Module) newMsgIn2() *RPCMsgIn2 {
+	if !m.pooled {
+		return &RPCMsgIn2{}
+	}
+	return msgIn2Pool.Get().(*RPCMsgIn2)
+}
+
+// releaseMsgIn2 makes the message available for reuse if messages are
+// pooled. The message must not be used afterwards.
+func (m *Module) releaseMsgIn2(in *RPCMsgIn2) {
+	if !m.pooled || in == nil {
+		return
+	}
+	*in = RPCMsgIn2{HeadersOut: reuseHeaders(in.HeadersOut)}
+	msgIn2Pool.Put(in)
+}
+
+// reuseHeaders returns the headers emptied for reuse, dropping the
+// references to the old values, or nil if too large to keep
+func reuseHeaders(h [][2]string) [][2]string {
+	if cap(h) > maxPooledHeaders {
+		return nil
+	}
+	clear(h)
+	return h[:0]
+}
+
+// bytesToString returns the bytes as a string without a copy, so the
+// bytes must not be modified while the string is in use
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
@@ -0,0 +1,157 @@
+package sigsci
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+func TestMsgPool(t *testing.T) {
+	m := &Module{pooled: true}
+	config, _ := NewModuleConfig()
+
+	req := httptest.NewRequest("POST", "/path", nil)
+	req.Header.Set("User-Agent", "test")
+	in := m.newMsgIn()
+	setRPCMsgIn(in, config, req, "body", -1, -1, 0)
+	in.HeadersOut = append(in.HeadersOut, [2]string{"Content-Type", "text/plain"})
+	headers := in.HeadersIn
+
+	m.releaseMsgIn(in)
+	if in.PostBody != "" || in.URI != "" || len(in.HeadersIn) != 0 || len(in.HeadersOut) != 0 {
+		t.Errorf("Message not reset: %+v", in)
+	}
+	if cap(in.HeadersIn) == 0 || headers[0][0] != "" {
+		t.Errorf("Headers not kept for reuse: %q", headers)
+	}
+
+	// The headers are reused when set again
+	setRPCMsgIn(in, config, req, "", 200, 0, 0)
+	if &in.HeadersIn[0] != &headers[0] || in.ResponseCode != 200 || in.PostBody != "" {
+		t.Errorf("Unexpected message: %+v", in)
+	}
+
+	// Messages given to a custom inspector are not reused
+	m.pooled = false
+	in2 := m.newMsgIn2()
+	in2.RequestID = "id"
+	m.releaseMsgIn2(in2)
+	if in2.RequestID != "id" {
+		t.Errorf("Message unexpectedly reset: %+v", in2)
+	}
+}
+
+// serveBenchAgent serves an agent allowing all requests, which only skips
+// over the messages so that its allocations do not skew the module's
+func serveBenchAgent(b *testing.B) string {
+	ln, err := net.Listen("unix", filepath.Join(b.TempDir(), "sigsci.sock"))
+	if err != nil {
+		b.Fatalf("Failed to listen: %s", err)
+	}
+	b.Cleanup(func() { ln.Close() })
+
+	allow, _ := (&RPCMsgOut{WAFResponse: 200}).MarshalMsg(nil)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				dec, enc := msgp.NewReader(conn), msgp.NewWriter(conn)
+				var method []byte
+				for {
+					// [type, seq, method, [params]] => [type, seq, error, result]
+					dec.ReadArrayHeader()
+					dec.ReadInt()
+					seq, _ := dec.ReadUint32()
+					method, _ = dec.ReadStringAsBytes(method[:0])
+					if err := dec.Skip(); err != nil {
+						return
+					}
+					enc.WriteArrayHeader(4)
+					enc.WriteInt(1)
+					enc.WriteUint32(seq)
+					enc.WriteNil()
+					if bytes.Equal(method, []byte("RPC.PreRequest")) || bytes.Equal(method, []byte("RPC.ModuleInit")) {
+						enc.Write(allow)
+					} else {
+						enc.WriteInt(0)
+					}
+					enc.Flush()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func benchmarkServeHTTP(b *testing.B, options ...ModuleConfigOption) {
+	options = append(options, Socket("unix", serveBenchAgent(b)), Timeout(time.Second))
+	m, err := NewModule(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(io.Discard, req.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusNotFound)
+	}), options...)
+	if err != nil {
+		b.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	body := strings.Repeat("a=1&", 256)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("POST", "/missing", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", "SigSci Module Benchmark")
+		m.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	benchmarkServeHTTP(b)
+}
+
+func BenchmarkServeHTTPMultiplexed(b *testing.B) {
+	benchmarkServeHTTP(b, MultiplexConnections(1))
+}
+
+func BenchmarkNewRPCMsgIn(b *testing.B) {
+	config, _ := NewModuleConfig()
+	req := httptest.NewRequest("POST", "/path", nil)
+	req.Header.Set("User-Agent", "SigSci Module Benchmark")
+	body := []byte(strings.Repeat("a=1&", 256))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in := NewRPCMsgIn(config, req, body, -1, -1, 0)
+		in.EncodeMsg(msgp.NewWriter(io.Discard))
+	}
+}
+
+func BenchmarkRPCMsgInPooled(b *testing.B) {
+	m := &Module{pooled: true}
+	config, _ := NewModuleConfig()
+	req := httptest.NewRequest("POST", "/path", nil)
+	req.Header.Set("User-Agent", "SigSci Module Benchmark")
+	body := []byte(strings.Repeat("a=1&", 256))
+	enc := msgp.NewWriter(io.Discard)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in := m.newMsgIn()
+		setRPCMsgIn(in, config, req, bytesToString(body), -1, -1, 0)
+		in.EncodeMsg(enc)
+		m.releaseMsgIn(in)
+	}
+}
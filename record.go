@@ -0,0 +1,281 @@
+package sigsci
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// ErrNotRecorded is returned by a ReplayInspector for a PreRequest call
+// without a recorded response
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Recording is a call made to an inspector, recorded as a line of JSON
+type Recording struct {
+	Time    time.Time     `json:"time"`            // Start of the call
+	Method  string        `json:"method"`          // RPC method (e.g., "RPC.PreRequest")
+	In      *RPCMsgIn     `json:"in,omitempty"`    // Input for ModuleInit, PreRequest and PostRequest
+	In2     *RPCMsgIn2    `json:"in2,omitempty"`   // Input for UpdateRequest
+	Batch   *RPCMsgBatch  `json:"batch,omitempty"` // Input for BatchRequest
+	Out     *RPCMsgOut    `json:"out,omitempty"`   // Output, if the call succeeded
+	Latency time.Duration `json:"latency"`         // Duration of the call, in nanoseconds
+	Error   string        `json:"error,omitempty"` // Error, if the call failed
+}
+
+// RecordingInspector is an Inspector that records every call made to
+// another inspector, with the response, latency and any error, as JSON
+// lines written to a writer (e.g., a file). This can be used to capture
+// the decisions made by an agent, to replay later with a ReplayInspector,
+// or to debug the traffic to an agent.
+type RecordingInspector struct {
+	inner   Inspector
+	insp    ContextInspector
+	batcher BatchInspector // nil if not supported by the inspector
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error // first write error
+}
+
+// NewRecordingInspector returns an inspector that records the calls made to
+// the inspector to the writer
+func NewRecordingInspector(insp Inspector, w io.Writer) *RecordingInspector {
+	ri := &RecordingInspector{
+		inner: insp,
+		insp:  NewContextInspector(insp),
+		enc:   json.NewEncoder(w),
+	}
+	ri.batcher, _ = insp.(BatchInspector)
+	return ri
+}
+
+// ModuleInit records a ModuleInit call
+func (ri *RecordingInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
+	return ri.ModuleInitContext(context.Background(), in, out)
+}
+
+// PreRequest records a PreRequest call
+func (ri *RecordingInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	return ri.PreRequestContext(context.Background(), in, out)
+}
+
+// PostRequest records a PostRequest call
+func (ri *RecordingInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	return ri.PostRequestContext(context.Background(), in, out)
+}
+
+// UpdateRequest records an UpdateRequest call
+func (ri *RecordingInspector) UpdateRequest(in *RPCMsgIn2, out *RPCMsgOut) error {
+	return ri.UpdateRequestContext(context.Background(), in, out)
+}
+
+// ModuleInitContext records a ModuleInit call
+func (ri *RecordingInspector) ModuleInitContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	return ri.record(Recording{Method: "RPC.ModuleInit", In: in}, out, func() error {
+		return ri.insp.ModuleInitContext(ctx, in, out)
+	})
+}
+
+// PreRequestContext records a PreRequest call
+func (ri *RecordingInspector) PreRequestContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	return ri.record(Recording{Method: "RPC.PreRequest", In: in}, out, func() error {
+		return ri.insp.PreRequestContext(ctx, in, out)
+	})
+}
+
+// PostRequestContext records a PostRequest call
+func (ri *RecordingInspector) PostRequestContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	return ri.record(Recording{Method: "RPC.PostRequest", In: in}, out, func() error {
+		return ri.insp.PostRequestContext(ctx, in, out)
+	})
+}
+
+// UpdateRequestContext records an UpdateRequest call
+func (ri *RecordingInspector) UpdateRequestContext(ctx context.Context, in *RPCMsgIn2, out *RPCMsgOut) error {
+	return ri.record(Recording{Method: "RPC.UpdateRequest", In2: in}, out, func() error {
+		return ri.insp.UpdateRequestContext(ctx, in, out)
+	})
+}
+
+// BatchRequest records a BatchRequest call. If the inspector does not
+// support batches, then the reports are sent (and recorded) individually.
+func (ri *RecordingInspector) BatchRequest(in *RPCMsgBatch, out *RPCMsgOut) error {
+	if ri.batcher != nil {
+		return ri.record(Recording{Method: "RPC.BatchRequest", Batch: in}, out, func() error {
+			return ri.batcher.BatchRequest(in, out)
+		})
+	}
+
+	var firstErr error
+	for i := range in.PostRequests {
+		if err := ri.PostRequest(&in.PostRequests[i], out); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for i := range in.UpdateRequests {
+		if err := ri.UpdateRequest(&in.UpdateRequests[i], out); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Err returns the first error writing a recording, if any
+func (ri *RecordingInspector) Err() error {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	return ri.err
+}
+
+// Close closes the inspector if it holds resources (e.g., a RPCInspector).
+// The writer is not closed.
+func (ri *RecordingInspector) Close() error {
+	if c, ok := ri.inner.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// record makes the call and writes the recording
+func (ri *RecordingInspector) record(rec Recording, out *RPCMsgOut, call func() error) error {
+	rec.Time = time.Now()
+	err := call()
+	rec.Latency = time.Since(rec.Time)
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		res := *out
+		rec.Out = &res
+	}
+
+	ri.mu.Lock()
+	if werr := ri.enc.Encode(&rec); werr != nil && ri.err == nil {
+		ri.err = fmt.Errorf("failed to write %s recording: %w", rec.Method, werr)
+	}
+	ri.mu.Unlock()
+
+	return err
+}
+
+// ReplayInspector is an Inspector that responds with the results recorded
+// by a RecordingInspector (e.g., to reproduce the decisions made by an agent
+// in tests).
+//
+// PreRequest calls are matched to recordings by the request method and URI,
+// with the recordings for the same request replayed in order, repeating
+// the last one once they are all used. A PreRequest call that does not
+// match a recording fails with ErrNotRecorded. Recorded errors are replayed
+// as errors with the same message.
+type ReplayInspector struct {
+	// Delay, if set, delays each replayed result by the recorded latency
+	Delay bool
+
+	mu         sync.Mutex
+	moduleInit *Recording
+	requests   map[string][]*Recording
+}
+
+// NewReplayInspector returns an inspector replaying the recordings read
+// from the reader
+func NewReplayInspector(r io.Reader) (*ReplayInspector, error) {
+	ri := &ReplayInspector{requests: make(map[string][]*Recording)}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 64*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		rec := &Recording{}
+		if err := json.Unmarshal(s.Bytes(), rec); err != nil {
+			return nil, fmt.Errorf("failed to read recording on line %d: %w", line, err)
+		}
+		switch rec.Method {
+		case "RPC.ModuleInit":
+			if ri.moduleInit == nil {
+				ri.moduleInit = rec
+			}
+		case "RPC.PreRequest":
+			if rec.In == nil {
+				return nil, fmt.Errorf("failed to read recording on line %d: missing input", line)
+			}
+			key := replayKey(rec.In)
+			ri.requests[key] = append(ri.requests[key], rec)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recordings: %w", err)
+	}
+	return ri, nil
+}
+
+// ModuleInit replays the first recorded ModuleInit result. If there is
+// none, it succeeds, enabling all the capabilities offered by the module
+// so that the recorded results are replayed as is.
+func (ri *ReplayInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
+	if ri.moduleInit == nil {
+		out.WAFResponse = 200
+		out.ProtocolVersion = schema.ProtocolVersion
+		out.Capabilities = in.Capabilities
+		return nil
+	}
+	return ri.replay(ri.moduleInit, out)
+}
+
+// PreRequest replays the next recorded PreRequest result for the request
+func (ri *ReplayInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	key := replayKey(in)
+	ri.mu.Lock()
+	recs := ri.requests[key]
+	if len(recs) == 0 {
+		ri.mu.Unlock()
+		return fmt.Errorf("%w for %s", ErrNotRecorded, key)
+	}
+	rec := recs[0]
+	if len(recs) > 1 {
+		ri.requests[key] = recs[1:]
+	}
+	ri.mu.Unlock()
+
+	return ri.replay(rec, out)
+}
+
+// PostRequest always succeeds without a response, as reports are not
+// replayed
+func (ri *ReplayInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	return nil
+}
+
+// UpdateRequest always succeeds without a response, as reports are not
+// replayed
+func (ri *ReplayInspector) UpdateRequest(in *RPCMsgIn2, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	return nil
+}
+
+// replay sets the output from the recording
+func (ri *ReplayInspector) replay(rec *Recording, out *RPCMsgOut) error {
+	if ri.Delay {
+		time.Sleep(rec.Latency)
+	}
+	if rec.Error != "" {
+		return errors.New(rec.Error)
+	}
+	if rec.Out != nil {
+		*out = *rec.Out
+	}
+	return nil
+}
+
+// replayKey is the key matching a request to its recordings
+func replayKey(in *RPCMsgIn) string {
+	return in.Method + " " + in.URI
+}
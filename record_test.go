@@ -0,0 +1,129 @@
+package sigsci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+func TestRecordReplay(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Header.Get("X-Sigsci-Tags")))
+	})
+
+	var buf bytes.Buffer
+	rec := NewRecordingInspector(newTestInspector(406, "XSS"), &buf)
+	m, err := NewModule(handler, CustomInspector(rec, nil, nil))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/blocked", nil))
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to shutdown module: %s", err)
+	}
+	if w.Code != 406 {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("Failed to record: %s", err)
+	}
+
+	// One line per call
+	var methods []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r Recording
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Failed to parse recording %q: %s", line, err)
+		}
+		methods = append(methods, r.Method)
+	}
+	if strings.Join(methods, ",") != "RPC.ModuleInit,RPC.PreRequest,RPC.UpdateRequest" {
+		t.Errorf("Unexpected recorded methods %q", methods)
+	}
+
+	// Add a recorded error, which fails open when replayed
+	failed := Recording{Method: "RPC.PreRequest", In: &RPCMsgIn{Method: "GET", URI: "/failed"}, Error: "agent down"}
+	json.NewEncoder(&buf).Encode(&failed)
+
+	replay, err := NewReplayInspector(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read recordings: %s", err)
+	}
+	m, err = NewModule(handler, CustomInspector(replay, nil, nil))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	cases := []struct {
+		uri    string
+		status int
+		body   string
+	}{
+		{"/blocked", 406, ""},
+		{"/blocked", 406, ""}, // the last recording repeats
+		{"/failed", 200, ""},
+		{"/unknown", 200, ""},
+	}
+	for pos, tt := range cases {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", tt.uri, nil))
+		if w.Code != tt.status {
+			t.Errorf("test %d: unexpected status code %d, expected %d", pos, w.Code, tt.status)
+		}
+	}
+
+	err = replay.PreRequest(&RPCMsgIn{Method: "GET", URI: "/unknown"}, &RPCMsgOut{})
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	err = replay.PreRequest(&RPCMsgIn{Method: "GET", URI: "/failed"}, &RPCMsgOut{})
+	if err == nil || err.Error() != "agent down" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestReplayResponseTypes(t *testing.T) {
+	// Without a recorded ModuleInit, the recorded response types are used
+	tarpit := Recording{
+		Method: "RPC.PreRequest",
+		In:     &RPCMsgIn{Method: "GET", URI: "/tarpit"},
+		Out:    &RPCMsgOut{WAFResponse: 200, Type: schema.Tarpit, StatusCode: 429, Body: []byte("slow down")},
+	}
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(&tarpit)
+	replay, err := NewReplayInspector(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read recordings: %s", err)
+	}
+	m, err := NewModule(http.NotFoundHandler(), CustomInspector(replay, nil, nil))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/tarpit", nil))
+	if w.Code != 429 || w.Body.String() != "slow down" {
+		t.Errorf("Unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestReplayInspectorInvalid(t *testing.T) {
+	_, err := NewReplayInspector(strings.NewReader("{\"method\":\"RPC.PreRequest\"}\n"))
+	if err == nil {
+		t.Errorf("Expected an error for a recording without input")
+	}
+	_, err = NewReplayInspector(strings.NewReader("not json\n"))
+	if err == nil {
+		t.Errorf("Expected an error for an invalid recording")
+	}
+}
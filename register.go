@@ -0,0 +1,47 @@
+package sigsci
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// register sends ModuleInit to the agent so that the agent knows about
+// this module, retrying with an exponential backoff until it succeeds or
+// the module is stopped. Only one registration is run at a time.
+func (m *Module) register() {
+	if !atomic.CompareAndSwapInt32(&m.registering, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&m.registering, 0)
+
+	backoff, maxBackoff := m.config.RegisterBackoff()
+	for {
+		in, out := m.moduleInitMsg(), RPCMsgOut{}
+		err := m.inspector.ModuleInit(&in, &out)
+		m.health.record(err)
+		if err == nil {
+			m.negotiate(&out)
+			if m.config.Debug() {
+				log.Printf("DEBUG: module registered with the agent")
+			}
+			// Send any reports spooled while the agent was unavailable
+			m.replaySpool()
+			return
+		}
+		if m.config.Debug() {
+			log.Printf("DEBUG: 'RPC.ModuleInit' registration failed (retrying in %s): %s", backoff, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-m.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
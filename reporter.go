@@ -0,0 +1,235 @@
+package sigsci
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReportPolicy decides what happens to a background report (a PostRequest
+// or UpdateRequest call made after the response) when the report queue is
+// full
+type ReportPolicy int
+
+const (
+	// ReportDropNewest drops the new report when the queue is full
+	ReportDropNewest ReportPolicy = iota
+	// ReportDropOldest drops the oldest queued report to make room for
+	// the new report when the queue is full, which requires a queue size
+	ReportDropOldest
+	// ReportBlock waits for room in the queue, delaying the handler
+	// returning until the report is queued
+	ReportBlock
+)
+
+func (p ReportPolicy) String() string {
+	switch p {
+	case ReportDropNewest:
+		return "drop-newest"
+	case ReportDropOldest:
+		return "drop-oldest"
+	case ReportBlock:
+		return "block"
+	}
+	return "unknown"
+}
+
+// reportJob is a background report along with the work to do once the
+// report is complete
+type reportJob struct {
+	send func() // makes the report call, nil if nothing to report
+	done func() // called after the report is sent or dropped, may be nil
+}
+
+func (j reportJob) run() {
+	if j.send != nil {
+		j.send()
+	}
+	if j.done != nil {
+		j.done()
+	}
+}
+
+// reporter makes background reports with a fixed number of workers
+// taking reports from a bounded queue
+type reporter struct {
+	policy  ReportPolicy
+	queue   chan reportJob
+	dropped uint64
+}
+
+func newReporter(workers, size int, policy ReportPolicy) *reporter {
+	r := &reporter{
+		policy: policy,
+		queue:  make(chan reportJob, size),
+	}
+	for i := 0; i < workers; i++ {
+		go r.work()
+	}
+	return r
+}
+
+func (r *reporter) work() {
+	for job := range r.queue {
+		job.run()
+	}
+}
+
+// submit queues the job, dropping a report according to the policy if
+// the queue is full
+func (r *reporter) submit(job reportJob) {
+	switch r.policy {
+	case ReportBlock:
+		r.queue <- job
+	case ReportDropOldest:
+		for {
+			select {
+			case r.queue <- job:
+				return
+			default:
+			}
+			select {
+			case old := <-r.queue:
+				r.drop(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case r.queue <- job:
+		default:
+			r.drop(job)
+		}
+	}
+}
+
+// drop drops the report, but still completes the job
+func (r *reporter) drop(job reportJob) {
+	atomic.AddUint64(&r.dropped, 1)
+	if job.done != nil {
+		job.done()
+	}
+}
+
+// close stops the workers once the queued reports are complete. No more
+// reports can be submitted.
+func (r *reporter) close() {
+	close(r.queue)
+}
+
+// Dropped returns the number of reports dropped
+func (r *reporter) Dropped() uint64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// reportBatcher coalesces reports into batches, which are sent once full
+// or once the window since the first report in the batch has passed
+type reportBatcher struct {
+	size   int
+	window time.Duration
+	send   func(batch *RPCMsgBatch, done []func())
+
+	mu     sync.Mutex
+	batch  *RPCMsgBatch
+	done   []func() // called after the batch is sent
+	timer  *time.Timer
+	closed bool // send reports without waiting to fill a batch
+}
+
+// add adds a PostRequest or UpdateRequest report to the current batch,
+// calling done once the batch is sent
+func (b *reportBatcher) add(post *RPCMsgIn, update *RPCMsgIn2, done func()) {
+	b.mu.Lock()
+	if b.batch == nil {
+		batch := &RPCMsgBatch{}
+		b.batch = batch
+		b.timer = time.AfterFunc(b.window, func() { b.flush(batch) })
+	}
+	if post != nil {
+		b.batch.PostRequests = append(b.batch.PostRequests, *post)
+	}
+	if update != nil {
+		b.batch.UpdateRequests = append(b.batch.UpdateRequests, *update)
+	}
+	if done != nil {
+		b.done = append(b.done, done)
+	}
+	var full *RPCMsgBatch
+	var fulldone []func()
+	if b.closed || len(b.batch.PostRequests)+len(b.batch.UpdateRequests) >= b.size {
+		full, fulldone = b.takeLocked()
+	}
+	b.mu.Unlock()
+
+	if full != nil {
+		b.send(full, fulldone)
+	}
+}
+
+// flush sends the given batch if it is still the current batch, or the
+// current batch (if any) if nil
+func (b *reportBatcher) flush(batch *RPCMsgBatch) {
+	b.mu.Lock()
+	if b.batch == nil || (batch != nil && b.batch != batch) {
+		b.mu.Unlock()
+		return
+	}
+	batch, done := b.takeLocked()
+	b.mu.Unlock()
+
+	b.send(batch, done)
+}
+
+// close sends the current batch (if any), with any later reports sent
+// without waiting to fill a batch
+func (b *reportBatcher) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.flush(nil)
+}
+
+func (b *reportBatcher) takeLocked() (*RPCMsgBatch, []func()) {
+	batch, done := b.batch, b.done
+	b.timer.Stop()
+	b.batch, b.done, b.timer = nil, nil, nil
+	return batch, done
+}
+
+// reportBatch sends the batch in the background, then calls each done
+func (m *Module) reportBatch(batch *RPCMsgBatch, done []func()) {
+	m.report(
+		func() { m.inspectorBatchRequest(batch) },
+		func() {
+			for _, fn := range done {
+				fn()
+			}
+		},
+	)
+}
+
+// report makes the report in the background, then calls done. Without a
+// report queue, a goroutine is used per report. The report is pending
+// until done is called.
+func (m *Module) report(send func(), done func()) {
+	if send == nil && done == nil {
+		return
+	}
+	job := reportJob{send: send, done: m.track(done)}
+	switch {
+	case send == nil || m.reports == nil:
+		go job.run()
+	default:
+		m.reports.submit(job)
+	}
+}
+
+// DroppedReports returns the number of background reports (PostRequest or
+// UpdateRequest calls, or batches of them if batching) dropped because the
+// report queue was full
+func (m *Module) DroppedReports() uint64 {
+	return m.reports.Dropped()
+}
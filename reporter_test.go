@@ -0,0 +1,242 @@
+package sigsci
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReporterDropNewest(t *testing.T) {
+	r := newReporter(1, 1, ReportDropNewest)
+	release := make(chan struct{})
+	var sent, done int32
+	job := func(id int32) reportJob {
+		return reportJob{
+			send: func() {
+				<-release
+				atomic.AddInt32(&sent, 1)
+			},
+			done: func() { atomic.AddInt32(&done, 1) },
+		}
+	}
+
+	// One running, one queued, then two dropped
+	r.submit(job(1))
+	waitFor(t, func() bool { return len(r.queue) == 0 })
+	for i := int32(2); i <= 4; i++ {
+		r.submit(job(i))
+	}
+	if n := r.Dropped(); n != 2 {
+		t.Errorf("Unexpected dropped=%d, expected=2", n)
+	}
+	close(release)
+	waitFor(t, func() bool { return atomic.LoadInt32(&done) == 4 })
+	if n := atomic.LoadInt32(&sent); n != 2 {
+		t.Errorf("Unexpected sent=%d, expected=2", n)
+	}
+}
+
+func TestReporterDropOldest(t *testing.T) {
+	r := newReporter(1, 1, ReportDropOldest)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var sent []int
+	job := func(id int) reportJob {
+		return reportJob{send: func() {
+			<-release
+			mu.Lock()
+			sent = append(sent, id)
+			mu.Unlock()
+		}}
+	}
+
+	r.submit(job(1))
+	waitFor(t, func() bool { return len(r.queue) == 0 })
+	r.submit(job(2))
+	r.submit(job(3))
+	if n := r.Dropped(); n != 1 {
+		t.Errorf("Unexpected dropped=%d, expected=1", n)
+	}
+	close(release)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 2
+	})
+	if sent[0] != 1 || sent[1] != 3 {
+		t.Errorf("Unexpected reports sent %v, expected [1 3]", sent)
+	}
+}
+
+func TestReporterBlock(t *testing.T) {
+	r := newReporter(1, 0, ReportBlock)
+	release := make(chan struct{})
+	r.submit(reportJob{send: func() { <-release }})
+
+	submitted := make(chan struct{})
+	go func() {
+		r.submit(reportJob{send: func() {}})
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("Expected submit to block while the worker is busy")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-submitted
+	if n := r.Dropped(); n != 0 {
+		t.Errorf("Unexpected dropped=%d, expected=0", n)
+	}
+}
+
+func TestReportQueueValidation(t *testing.T) {
+	if _, err := NewModuleConfig(ReportQueue(-1, 10)); err == nil {
+		t.Error("Expected an error for negative workers")
+	}
+	if _, err := NewModuleConfig(ReportQueue(1, -1)); err == nil {
+		t.Error("Expected an error for a negative queue size")
+	}
+	if _, err := NewModuleConfig(ReportDropPolicy(ReportPolicy(99))); err == nil {
+		t.Error("Expected an error for an invalid policy")
+	}
+	// Nothing can be dropped from an unbuffered queue, in either order
+	if _, err := NewModuleConfig(ReportQueue(1, 0), ReportDropPolicy(ReportDropOldest)); err == nil {
+		t.Error("Expected an error for dropping the oldest reports without a queue")
+	}
+	if _, err := NewModuleConfig(ReportDropPolicy(ReportDropOldest), ReportQueue(1, 0)); err == nil {
+		t.Error("Expected an error for dropping the oldest reports without a queue")
+	}
+	if _, err := NewModuleConfig(ReportDropPolicy(ReportDropOldest), ReportQueue(1, 1)); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+// blockingInspector is a custom inspector where reports block until released
+type blockingInspector struct {
+	testInspector
+	release chan struct{}
+	reports int32
+}
+
+func (insp *blockingInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	<-insp.release
+	atomic.AddInt32(&insp.reports, 1)
+	return insp.testInspector.PostRequest(in, out)
+}
+
+func TestModuleReportQueue(t *testing.T) {
+	insp := &blockingInspector{testInspector: testInspector{resp: 200}, release: make(chan struct{})}
+	var finis int32
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// Anomaly, so a PostRequest report is made
+			w.WriteHeader(http.StatusNotFound)
+		}),
+		CustomInspector(insp, nil, func(_ *http.Request) { atomic.AddInt32(&finis, 1) }),
+		ReportQueue(1, 2),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+
+	// One report in progress, two queued and two dropped
+	for i := 0; i < 5; i++ {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		if i == 0 {
+			waitFor(t, func() bool { return len(m.reports.queue) == 0 })
+		}
+	}
+	if n := m.DroppedReports(); n != 2 {
+		t.Errorf("Unexpected dropped reports=%d, expected=2", n)
+	}
+
+	// The finalizer is still called for dropped reports
+	close(insp.release)
+	waitFor(t, func() bool { return atomic.LoadInt32(&finis) == 5 })
+	if n := atomic.LoadInt32(&insp.reports); n != 3 {
+		t.Errorf("Unexpected reports=%d, expected=3", n)
+	}
+}
+
+// batchInspector is a custom inspector recording the batches sent
+type batchInspector struct {
+	testInspector
+	mu      sync.Mutex
+	batches []*RPCMsgBatch
+}
+
+func (insp *batchInspector) BatchRequest(in *RPCMsgBatch, out *RPCMsgOut) error {
+	insp.mu.Lock()
+	insp.batches = append(insp.batches, in)
+	insp.mu.Unlock()
+	return nil
+}
+
+func (insp *batchInspector) Batches() []*RPCMsgBatch {
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	return append([]*RPCMsgBatch(nil), insp.batches...)
+}
+
+func TestModuleReportBatch(t *testing.T) {
+	insp := &batchInspector{testInspector: testInspector{resp: 200, tags: "XSS"}}
+	var finis int32
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}),
+		CustomInspector(insp, nil, func(_ *http.Request) { atomic.AddInt32(&finis, 1) }),
+		ReportBatch(3, 50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+
+	// A full batch is sent immediately (the tags result in UpdateRequests)
+	for i := 0; i < 3; i++ {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	waitFor(t, func() bool { return len(insp.Batches()) == 1 })
+	if b := insp.Batches()[0]; len(b.UpdateRequests) != 3 || len(b.PostRequests) != 0 {
+		t.Errorf("Unexpected batch with %d PostRequests and %d UpdateRequests", len(b.PostRequests), len(b.UpdateRequests))
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&finis) == 3 })
+
+	// A partial batch is sent after the window
+	insp.tags = ""
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	if n := len(insp.Batches()); n != 1 {
+		t.Errorf("Unexpected batches=%d before the window, expected=1", n)
+	}
+	waitFor(t, func() bool { return len(insp.Batches()) == 2 })
+	if b := insp.Batches()[1]; len(b.UpdateRequests) != 0 || len(b.PostRequests) != 1 {
+		t.Errorf("Unexpected batch with %d PostRequests and %d UpdateRequests", len(b.PostRequests), len(b.UpdateRequests))
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&finis) == 4 })
+}
+
+func TestModuleReportBatchFallback(t *testing.T) {
+	// The inspector does not support batches
+	insp := &blockingInspector{testInspector: testInspector{resp: 200}, release: make(chan struct{})}
+	close(insp.release)
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}),
+		CustomInspector(insp, nil, nil),
+		ReportBatch(2, time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&insp.reports) == 2 })
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/http"
 
@@ -81,21 +82,11 @@ func (w *responseRecorder) WriteHeader(status int) {
 	w.base.WriteHeader(status)
 }
 
+// mergeHeader applies the response actions from the agent to the header
+// before it is written
 func (w *responseRecorder) mergeHeader() {
-	hdr := w.base.Header()
-	for _, a := range w.actions {
-		switch a.Code {
-		case schema.AddHdr:
-			hdr.Add(a.Args[0], a.Args[1])
-		case schema.SetHdr:
-			hdr.Set(a.Args[0], a.Args[1])
-		case schema.SetNEHdr:
-			if len(hdr.Get(a.Args[0])) == 0 {
-				hdr.Set(a.Args[0], a.Args[1])
-			}
-		case schema.DelHdr:
-			hdr.Del(a.Args[0])
-		}
+	if err := applyHeaderActions(w.base.Header(), w.actions); err != nil {
+		log.Printf("ERROR: Received invalid response actions from inspector (skipped): %s", err)
 	}
 	w.actions = nil
 }
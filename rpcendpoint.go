@@ -0,0 +1,204 @@
+package sigsci
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RPCEndpoint is an address of an agent
+type RPCEndpoint struct {
+	Network string
+	Address string
+}
+
+func (e RPCEndpoint) String() string {
+	return e.Network + ":" + e.Address
+}
+
+// BalancePolicy decides the order in which agent endpoints are used
+type BalancePolicy int
+
+const (
+	// BalanceFailover uses the endpoints in the configured order, only
+	// using the next endpoint if the previous one fails
+	BalanceFailover BalancePolicy = iota
+	// BalanceRoundRobin spreads calls evenly over the endpoints
+	BalanceRoundRobin
+	// BalanceLeastLatency uses the endpoint with the lowest recent latency
+	BalanceLeastLatency
+)
+
+func (p BalancePolicy) String() string {
+	switch p {
+	case BalanceFailover:
+		return "failover"
+	case BalanceRoundRobin:
+		return "round-robin"
+	case BalanceLeastLatency:
+		return "least-latency"
+	}
+	return "unknown"
+}
+
+const (
+	// endpointRetryMin is how long a failed endpoint is avoided
+	endpointRetryMin = 1 * time.Second
+	// endpointRetryMax caps how long a repeatedly failing endpoint is avoided
+	endpointRetryMax = 30 * time.Second
+)
+
+// endpoint is an agent endpoint along with its connections and health
+type endpoint struct {
+	RPCEndpoint
+	dial func(ctx context.Context) (net.Conn, error)
+	pool *connPool   // nil if not pooling
+	mux  *muxClients // nil if not multiplexing
+
+	latency int64 // moving average of the call latency in nanoseconds
+
+	mu        sync.Mutex
+	failures  int // consecutive failures
+	downUntil time.Time
+}
+
+// call makes a call to the endpoint using the configured connection type,
+// which must complete before the context is done, and within the timeout
+// (if set) once connected
+func (ep *endpoint) call(ctx context.Context, method string, in, out interface{}, timeout time.Duration) error {
+	switch {
+	case ep.mux != nil:
+		return ep.mux.call(ctx, method, in, out, timeout)
+	case ep.pool != nil:
+		return ep.pool.call(ctx, method, in, out, timeout)
+	}
+
+	conn, err := ep.dial(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withCallTimeout(ctx, timeout)
+	defer cancel()
+	client := rpc.NewClientWithCodec(NewMsgpClientCodec(conn))
+	err = callConn(ctx, conn, client, method, in, out)
+	client.Close()
+	return err
+}
+
+// withCallTimeout returns the context for a call once connected, limited
+// by the timeout if set
+func withCallTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// available returns false while a failed endpoint should be avoided
+func (ep *endpoint) available(now time.Time) bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return !now.Before(ep.downUntil)
+}
+
+// success records a successful call
+func (ep *endpoint) success(d time.Duration) {
+	ep.mu.Lock()
+	ep.failures = 0
+	ep.downUntil = time.Time{}
+	ep.mu.Unlock()
+
+	// exponentially weighted moving average (1/8 weight to the new sample)
+	for {
+		old := atomic.LoadInt64(&ep.latency)
+		avg := int64(d)
+		if old > 0 {
+			avg = old + (int64(d)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&ep.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// failure records a failed call, avoiding the endpoint for a while
+func (ep *endpoint) failure(err error) {
+	ep.mu.Lock()
+	ep.failures++
+	retry := endpointRetryMin << uint(ep.failures-1)
+	if retry > endpointRetryMax || retry <= 0 {
+		retry = endpointRetryMax
+	}
+	ep.downUntil = time.Now().Add(retry)
+	ep.mu.Unlock()
+
+	if err == errCallTimeout {
+		// Only the call timed out, the shared connections are still usable
+		return
+	}
+
+	// Drop any connections so that new connections are made, which
+	// also re-resolves any hostname in the address
+	switch {
+	case ep.mux != nil:
+		ep.mux.flush()
+	case ep.pool != nil:
+		ep.pool.flush()
+	}
+}
+
+func (ep *endpoint) close() error {
+	switch {
+	case ep.mux != nil:
+		return ep.mux.close()
+	case ep.pool != nil:
+		return ep.pool.close()
+	}
+	return nil
+}
+
+// endpointBalancer orders the endpoints for each call
+type endpointBalancer struct {
+	policy    BalancePolicy
+	endpoints []*endpoint
+	next      uint32
+}
+
+// order returns the endpoints in the order to try them, based on the
+// policy, with any endpoints that recently failed moved to the end
+func (b *endpointBalancer) order() []*endpoint {
+	if len(b.endpoints) == 1 {
+		return b.endpoints
+	}
+
+	eps := make([]*endpoint, 0, len(b.endpoints))
+	switch b.policy {
+	case BalanceRoundRobin:
+		start := int(atomic.AddUint32(&b.next, 1) % uint32(len(b.endpoints)))
+		eps = append(eps, b.endpoints[start:]...)
+		eps = append(eps, b.endpoints[:start]...)
+	case BalanceLeastLatency:
+		eps = append(eps, b.endpoints...)
+		sort.SliceStable(eps, func(i, j int) bool {
+			return atomic.LoadInt64(&eps[i].latency) < atomic.LoadInt64(&eps[j].latency)
+		})
+	default:
+		eps = append(eps, b.endpoints...)
+	}
+
+	now := time.Now()
+	ordered := make([]*endpoint, 0, len(eps))
+	var down []*endpoint
+	for _, ep := range eps {
+		if ep.available(now) {
+			ordered = append(ordered, ep)
+		} else {
+			down = append(down, ep)
+		}
+	}
+	return append(ordered, down...)
+}
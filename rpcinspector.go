@@ -1,9 +1,15 @@
 package sigsci
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"log"
 	"net"
 	"net/rpc"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,75 +21,160 @@ type RPCInspector struct {
 	Debug             bool
 	InitRPCClientFunc func() (*rpc.Client, error)
 	FiniRPCClientFunc func(*rpc.Client, error)
+
+	// DialTimeout, if set, limits the time to connect to the agent, with
+	// the call timeout starting once connected. Otherwise connecting is
+	// only limited by the call timeout.
+	DialTimeout time.Duration
+	// ReportTimeout, if set, is used instead of the Timeout for the
+	// PostRequest and UpdateRequest calls made after the response
+	ReportTimeout time.Duration
+
+	// Endpoints is an ordered list of agent endpoints to use instead
+	// of the single Network/Address endpoint
+	Endpoints []RPCEndpoint
+	// Balance is how calls are spread over multiple endpoints
+	Balance BalancePolicy
+	// TLSConfig, if set, is used to make TLS connections to `tcp` endpoints
+	TLSConfig *tls.Config
+
+	// MaxIdleConns is the maximum number of idle connections kept open
+	// to the agent for reuse. If zero, a new connection is made per call.
+	MaxIdleConns int
+	// MinIdleConns is the number of idle connections kept open even
+	// when they exceed the IdleTimeout, which are redialed in the
+	// background if they fail
+	MinIdleConns int
+	// IdleTimeout is how long an idle connection is kept before it is
+	// closed. If zero, idle connections are kept indefinitely.
+	IdleTimeout time.Duration
+	// MultiplexConns is the number of long-lived connections shared by
+	// concurrent calls. If set, this takes precedence over pooling. A
+	// connection is closed if writing a request takes over the Timeout.
+	MultiplexConns int
+
+	initOnce sync.Once
+	balancer *endpointBalancer
+	noBatch  int32 // set if the agent does not support RPC.BatchRequest
 }
 
 // ModuleInit sends a RPC.ModuleInit message to the agent
 func (ri *RPCInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
-	client, err := ri.GetRPCClient()
-	if err == nil {
-		err = client.Call("RPC.ModuleInit", in, out)
-		ri.CloseRPCClient(client, err)
-	}
-
-	if err != nil {
-		return fmt.Errorf("RPC.ModuleInit call failed: %s", err)
-	}
-
-	return nil
+	return ri.ModuleInitContext(context.Background(), in, out)
 }
 
 // PreRequest sends a RPC.PreRequest message to the agent
 func (ri *RPCInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
-	client, err := ri.GetRPCClient()
-	if err == nil {
-		err = client.Call("RPC.PreRequest", in, out)
-		ri.CloseRPCClient(client, err)
-	}
+	return ri.PreRequestContext(context.Background(), in, out)
+}
 
-	if err != nil {
-		return fmt.Errorf("RPC.PreRequest call failed: %s", err)
+// PostRequest sends a RPC.PostRequest message to the agent
+func (ri *RPCInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	return ri.PostRequestContext(context.Background(), in, out)
+}
+
+// UpdateRequest sends a RPC.UpdateRequest message to the agent
+func (ri *RPCInspector) UpdateRequest(in *RPCMsgIn2, out *RPCMsgOut) error {
+	return ri.UpdateRequestContext(context.Background(), in, out)
+}
+
+// ModuleInitContext sends a RPC.ModuleInit message to the agent
+func (ri *RPCInspector) ModuleInitContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	if err := ri.call(ctx, "RPC.ModuleInit", in, out, ri.Timeout); err != nil {
+		return fmt.Errorf("RPC.ModuleInit call failed: %w", err)
 	}
 
 	return nil
 }
 
-// PostRequest sends a RPC.PostRequest message to the agent
-func (ri *RPCInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
-	client, err := ri.GetRPCClient()
-	if err == nil {
-		var rpcout int
-		err = client.Call("RPC.PostRequest", in, &rpcout)
-		ri.CloseRPCClient(client, err)
+// PreRequestContext sends a RPC.PreRequest message to the agent
+func (ri *RPCInspector) PreRequestContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	if err := ri.call(ctx, "RPC.PreRequest", in, out, ri.Timeout); err != nil {
+		return fmt.Errorf("RPC.PreRequest call failed: %w", err)
+	}
 
-		// Always success as the rpcout is not currently used
-		out.WAFResponse = 200
-		out.RequestID = ""
-		out.RequestHeaders = nil
+	return nil
+}
+
+// PostRequestContext sends a RPC.PostRequest message to the agent
+func (ri *RPCInspector) PostRequestContext(ctx context.Context, in *RPCMsgIn, out *RPCMsgOut) error {
+	var rpcout RPCReportOut
+	if err := ri.call(ctx, "RPC.PostRequest", in, &rpcout, ri.reportTimeout()); err != nil {
+		return fmt.Errorf("RPC.PostRequest call failed: %w", err)
 	}
+	setReportOut(out, &rpcout)
 
-	if err != nil {
-		return fmt.Errorf("RPC.PostRequest call failed: %s", err)
+	return nil
+}
+
+// UpdateRequestContext sends a RPC.UpdateRequest message to the agent
+func (ri *RPCInspector) UpdateRequestContext(ctx context.Context, in *RPCMsgIn2, out *RPCMsgOut) error {
+	var rpcout RPCReportOut
+	if err := ri.call(ctx, "RPC.UpdateRequest", in, &rpcout, ri.reportTimeout()); err != nil {
+		return err
 	}
+	setReportOut(out, &rpcout)
 
 	return nil
 }
 
-// UpdateRequest sends a RPC.UpdateRequest message to the agent
-func (ri *RPCInspector) UpdateRequest(in *RPCMsgIn2, out *RPCMsgOut) error {
-	client, err := ri.GetRPCClient()
-	if err == nil {
+// setReportOut sets the output from the agent's reply to a report, which
+// is a success without a response if the agent replied with an integer
+func setReportOut(out *RPCMsgOut, rpcout *RPCReportOut) {
+	*out = rpcout.Out
+	if out.WAFResponse == 0 {
+		out.WAFResponse = 200
+	}
+}
 
+// BatchRequest sends a RPC.BatchRequest message to the agent. If the agent
+// does not support batches, then the reports are sent individually with
+// RPC.PostRequest and RPC.UpdateRequest messages instead. There is no
+// response to the individual reports in a batch.
+func (ri *RPCInspector) BatchRequest(in *RPCMsgBatch, out *RPCMsgOut) error {
+	if atomic.LoadInt32(&ri.noBatch) == 0 {
 		var rpcout int
-		err = client.Call("RPC.UpdateRequest", in, &rpcout)
-		ri.CloseRPCClient(client, err)
+		err := ri.call(context.Background(), "RPC.BatchRequest", in, &rpcout, ri.reportTimeout())
+		if !isUnknownMethod(err) {
+			if err != nil {
+				return fmt.Errorf("RPC.BatchRequest call failed: %w", err)
+			}
 
-		// Always success as the rpcout is not currently used
-		out.WAFResponse = 200
-		out.RequestID = ""
-		out.RequestHeaders = nil
+			// Always success as the rpcout is not currently used
+			out.WAFResponse = 200
+			out.RequestID = ""
+			out.RequestHeaders = nil
+
+			return nil
+		}
+
+		// An older agent, so do not try batches again
+		atomic.StoreInt32(&ri.noBatch, 1)
+		if ri.Debug {
+			log.Printf("DEBUG: agent does not support RPC.BatchRequest, sending reports individually: %s", err)
+		}
 	}
 
-	return err
+	var firstErr error
+	for i := range in.PostRequests {
+		if err := ri.PostRequest(&in.PostRequests[i], out); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for i := range in.UpdateRequests {
+		if err := ri.UpdateRequest(&in.UpdateRequests[i], out); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close closes any pooled or shared connections to the agent
+func (ri *RPCInspector) Close() error {
+	for _, ep := range ri.getBalancer().endpoints {
+		ep.close()
+	}
+	return nil
 }
 
 // GetRPCClient gets a RPC client
@@ -109,17 +200,151 @@ func (ri *RPCInspector) CloseRPCClient(client *rpc.Client, err error) {
 	client.Close()
 }
 
+// call makes a RPC call to the agent, trying each endpoint in turn until
+// one succeeds. The calls must complete within the timeout (once connected
+// if a DialTimeout is set) or before the context deadline, whichever is
+// sooner, and are abandoned if the context is cancelled.
+func (ri *RPCInspector) call(ctx context.Context, method string, in, out interface{}, timeout time.Duration) error {
+	if ri.InitRPCClientFunc != nil {
+		client, err := ri.GetRPCClient()
+		if err != nil {
+			return err
+		}
+		call, err := goContext(ctx, client, method, in, out)
+		if err != nil {
+			// Only release the client once the abandoned call completes
+			go func() {
+				<-call.Done
+				ri.CloseRPCClient(client, call.Error)
+			}()
+			return err
+		}
+		ri.CloseRPCClient(client, call.Error)
+		return call.Error
+	}
+
+	// Without a DialTimeout, the timeout includes connecting (over all the
+	// endpoints tried), and otherwise starts once connected to an endpoint
+	parent := ctx
+	callTimeout := timeout
+	if ri.DialTimeout <= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		callTimeout = 0
+	}
+
+	var err error
+	for _, ep := range ri.getBalancer().order() {
+		if ctx.Err() != nil {
+			break
+		}
+		start := time.Now()
+		err = ep.call(ctx, method, in, out, callTimeout)
+		if _, ok := err.(rpc.ServerError); ok || err == nil {
+			ep.success(time.Since(start))
+			return err
+		}
+		if perr := contextError(parent); perr != nil {
+			// The caller gave up, which says nothing about the endpoint
+			return perr
+		}
+		ep.failure(err)
+		if ri.Debug {
+			log.Printf("DEBUG: %s call to agent endpoint %s failed: %s", method, ep, err)
+		}
+	}
+	return err
+}
+
+// isUnknownMethod returns true if the error is from the agent not
+// supporting the called method
+func isUnknownMethod(err error) bool {
+	serr, ok := err.(rpc.ServerError)
+	return ok && strings.Contains(string(serr), "can't find")
+}
+
+// reportTimeout returns the timeout for calls reporting response data
+func (ri *RPCInspector) reportTimeout() time.Duration {
+	if ri.ReportTimeout > 0 {
+		return ri.ReportTimeout
+	}
+	return ri.Timeout
+}
+
+// contextError returns the context error, treating a passed deadline as
+// exceeded, as a connection deadline can expire just before the context
+// is marked as done
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func (ri *RPCInspector) getBalancer() *endpointBalancer {
+	ri.initOnce.Do(func() {
+		endpoints := ri.Endpoints
+		if len(endpoints) == 0 {
+			endpoints = []RPCEndpoint{{Network: ri.Network, Address: ri.Address}}
+		}
+		ri.balancer = &endpointBalancer{policy: ri.Balance}
+		for _, e := range endpoints {
+			ep := &endpoint{RPCEndpoint: e}
+			ep.dial = func(ctx context.Context) (net.Conn, error) {
+				return ri.dial(ctx, ep.RPCEndpoint)
+			}
+			switch {
+			case ri.MultiplexConns > 0:
+				ep.mux = newMuxClients(ep.dial, ri.MultiplexConns, ri.Timeout)
+			case ri.MaxIdleConns > 0:
+				ep.pool = newConnPool(ep.dial, ri.MinIdleConns, ri.MaxIdleConns, ri.IdleTimeout, ri.Timeout)
+				ep.pool.refill()
+			}
+			ri.balancer.endpoints = append(ri.balancer.endpoints, ep)
+		}
+	})
+	return ri.balancer
+}
+
+func (ri *RPCInspector) dial(ctx context.Context, e RPCEndpoint) (net.Conn, error) {
+	if ri.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ri.DialTimeout)
+		defer cancel()
+	}
+	if ri.TLSConfig != nil && e.Network == "tcp" {
+		// The context deadline includes the TLS handshake
+		d := &tls.Dialer{Config: ri.TLSConfig}
+		return d.DialContext(ctx, e.Network, e.Address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, e.Network, e.Address)
+}
+
 func (ri *RPCInspector) makeConnection() (net.Conn, error) {
 	deadline := time.Now().Add(ri.Timeout)
-	conn, err := net.DialTimeout(ri.Network, ri.Address, ri.Timeout)
+	ctx := context.Background()
+	if ri.DialTimeout <= 0 {
+		// Without a dial timeout, the timeout includes the time to connect
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	conn, err := ri.dial(ctx, RPCEndpoint{Network: ri.Network, Address: ri.Address})
 	if err != nil {
 		return nil, err
 	}
+	if ri.DialTimeout > 0 {
+		deadline = time.Now().Add(ri.Timeout)
+	}
 	conn.SetDeadline(deadline)
 	return conn, nil
 }
 
 func (ri *RPCInspector) getConnection() (net.Conn, error) {
-	// here for future expansion to use pools, etc.
 	return ri.makeConnection()
 }
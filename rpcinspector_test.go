@@ -0,0 +1,863 @@
+package sigsci
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/rpc"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// testAgent is a minimal msgpack RPC agent listening on a unix socket
+type testAgent struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	accepted int
+	delay    time.Duration
+	calls    map[string]int
+	noBatch  bool // simulate an agent without RPC.BatchRequest
+}
+
+func newTestAgent(t *testing.T) *testAgent {
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "sigsci.sock"))
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	return newTestAgentListener(t, ln)
+}
+
+// newTLSTestAgent creates a test agent listening for TLS on a local TCP port
+func newTLSTestAgent(t *testing.T, config *tls.Config) *testAgent {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	return newTestAgentListener(t, ln)
+}
+
+func newTestAgentListener(t *testing.T, ln net.Listener) *testAgent {
+	a := &testAgent{ln: ln}
+	t.Cleanup(a.close)
+	go a.serve()
+	return a
+}
+
+func (a *testAgent) serve() {
+	for {
+		conn, err := a.ln.Accept()
+		if err != nil {
+			return
+		}
+		a.mu.Lock()
+		a.conns = append(a.conns, conn)
+		a.accepted++
+		a.mu.Unlock()
+		go a.handle(conn)
+	}
+}
+
+func (a *testAgent) handle(conn net.Conn) {
+	defer conn.Close()
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return
+		}
+	}
+	dec := msgp.NewReader(conn)
+	enc := msgp.NewWriter(conn)
+	for {
+		// [type, seq, method, [arg]]
+		if _, err := dec.ReadArrayHeader(); err != nil {
+			return
+		}
+		if _, err := dec.ReadInt(); err != nil {
+			return
+		}
+		seq, err := dec.ReadUint32()
+		if err != nil {
+			return
+		}
+		method, err := dec.ReadString()
+		if err != nil {
+			return
+		}
+		if _, err := dec.ReadArrayHeader(); err != nil {
+			return
+		}
+
+		a.mu.Lock()
+		if a.calls == nil {
+			a.calls = make(map[string]int)
+		}
+		a.calls[method]++
+		noBatch := a.noBatch
+		a.mu.Unlock()
+
+		var reply msgp.Encodable
+		var rerr string
+		switch {
+		case method == "RPC.BatchRequest" && noBatch:
+			err = dec.Skip()
+			rerr = "rpc: can't find method " + method
+			method = ""
+		}
+		switch method {
+		case "RPC.ModuleInit", "RPC.PreRequest":
+			var in RPCMsgIn
+			err = in.DecodeMsg(dec)
+			reply = &RPCMsgOut{WAFResponse: 200}
+		case "RPC.PostRequest":
+			var in RPCMsgIn
+			err = in.DecodeMsg(dec)
+		case "RPC.UpdateRequest":
+			var in RPCMsgIn2
+			err = in.DecodeMsg(dec)
+		case "RPC.BatchRequest":
+			var in RPCMsgBatch
+			err = in.DecodeMsg(dec)
+		case "":
+		default:
+			err = dec.Skip()
+			rerr = "rpc: can't find method " + method
+		}
+		if err != nil {
+			return
+		}
+
+		a.mu.Lock()
+		delay := a.delay
+		a.mu.Unlock()
+		time.Sleep(delay)
+
+		// [type, seq, error, result]
+		enc.WriteArrayHeader(4)
+		enc.WriteInt(1)
+		enc.WriteUint32(seq)
+		switch {
+		case rerr != "":
+			enc.WriteString(rerr)
+			enc.WriteNil()
+		case reply != nil:
+			enc.WriteNil()
+			reply.EncodeMsg(enc)
+		default:
+			enc.WriteNil()
+			enc.WriteInt(0)
+		}
+		if err := enc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Accepted returns the number of connections accepted by the agent
+func (a *testAgent) Accepted() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.accepted
+}
+
+// Calls returns the number of calls to the method received by the agent
+func (a *testAgent) Calls(method string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[method]
+}
+
+// SetDelay sets how long the agent waits before replying
+func (a *testAgent) SetDelay(d time.Duration) {
+	a.mu.Lock()
+	a.delay = d
+	a.mu.Unlock()
+}
+
+// closeConns closes all current connections, simulating an agent restart
+func (a *testAgent) closeConns() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, conn := range a.conns {
+		conn.Close()
+	}
+	a.conns = nil
+}
+
+func (a *testAgent) close() {
+	a.ln.Close()
+	a.closeConns()
+}
+
+func TestRPCInspectorDialPerCall(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network: "unix",
+		Address: agent.ln.Addr().String(),
+		Timeout: time.Second,
+	}
+
+	for i := 0; i < 5; i++ {
+		out := RPCMsgOut{}
+		if err := ri.PreRequest(&RPCMsgIn{}, &out); err != nil {
+			t.Fatalf("call %d: PreRequest failed: %s", i, err)
+		}
+		if out.WAFResponse != 200 {
+			t.Errorf("call %d: unexpected WAFResponse=%d", i, out.WAFResponse)
+		}
+	}
+	if n := agent.Accepted(); n != 5 {
+		t.Errorf("Unexpected number of connections=%d, expected=5", n)
+	}
+}
+
+func TestRPCInspectorPool(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network:      "unix",
+		Address:      agent.ln.Addr().String(),
+		Timeout:      time.Second,
+		MaxIdleConns: 2,
+	}
+	defer ri.Close()
+
+	for i := 0; i < 10; i++ {
+		out := RPCMsgOut{}
+		if err := ri.PreRequest(&RPCMsgIn{}, &out); err != nil {
+			t.Fatalf("call %d: PreRequest failed: %s", i, err)
+		}
+		if err := ri.UpdateRequest(&RPCMsgIn2{}, &out); err != nil {
+			t.Fatalf("call %d: UpdateRequest failed: %s", i, err)
+		}
+	}
+	if n := agent.Accepted(); n != 1 {
+		t.Errorf("Unexpected number of connections=%d, expected=1", n)
+	}
+
+	// Dropped idle connections should be evicted and replaced
+	agent.closeConns()
+	time.Sleep(10 * time.Millisecond)
+	if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+		t.Fatalf("PreRequest after agent restart failed: %s", err)
+	}
+	if n := agent.Accepted(); n != 2 {
+		t.Errorf("Unexpected number of connections=%d, expected=2", n)
+	}
+}
+
+func TestRPCInspectorPoolMinIdle(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network:      "unix",
+		Address:      agent.ln.Addr().String(),
+		Timeout:      time.Second,
+		MinIdleConns: 2,
+		MaxIdleConns: 4,
+	}
+	defer ri.Close()
+
+	pool := ri.getBalancer().endpoints[0].pool
+	idle := func() int {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return len(pool.idle)
+	}
+	waitFor(t, func() bool { return idle() == 2 })
+
+	// Flushed connections (e.g., after an endpoint failure) are replaced
+	pool.flush()
+	waitFor(t, func() bool { return idle() == 2 && agent.Accepted() == 4 })
+
+	// As are connections that fail in a call
+	agent.closeConns()
+	time.Sleep(10 * time.Millisecond)
+	if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+		t.Fatalf("PreRequest after agent restart failed: %s", err)
+	}
+	waitFor(t, func() bool { return idle() >= 2 })
+}
+
+func TestRPCInspectorPoolConcurrent(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network:      "unix",
+		Address:      agent.ln.Addr().String(),
+		Timeout:      time.Second,
+		MaxIdleConns: 4,
+	}
+	defer ri.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+				t.Errorf("PreRequest failed: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	pool := ri.getBalancer().endpoints[0].pool
+	pool.mu.Lock()
+	idle := len(pool.idle)
+	pool.mu.Unlock()
+	if idle > 4 {
+		t.Errorf("Unexpected number of idle connections=%d, expected at most 4", idle)
+	}
+}
+
+func TestRPCInspectorRemoteError(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network:      "unix",
+		Address:      agent.ln.Addr().String(),
+		Timeout:      time.Second,
+		MaxIdleConns: 1,
+	}
+	defer ri.Close()
+
+	err := ri.call(context.Background(), "RPC.Unknown", &RPCMsgIn{}, &RPCMsgOut{}, ri.Timeout)
+	if _, ok := err.(rpc.ServerError); !ok {
+		t.Fatalf("Unexpected error type %T: %v", err, err)
+	}
+	if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+		t.Fatalf("PreRequest failed: %s", err)
+	}
+	if n := agent.Accepted(); n != 1 {
+		t.Errorf("Unexpected number of connections=%d, expected=1", n)
+	}
+}
+
+func TestRPCInspectorMultiplex(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network:        "unix",
+		Address:        agent.ln.Addr().String(),
+		Timeout:        time.Second,
+		MultiplexConns: 2,
+	}
+	defer ri.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := RPCMsgOut{}
+			if err := ri.PreRequest(&RPCMsgIn{}, &out); err != nil {
+				t.Errorf("PreRequest failed: %s", err)
+			}
+			if out.WAFResponse != 200 {
+				t.Errorf("Unexpected WAFResponse=%d", out.WAFResponse)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := agent.Accepted(); n != 2 {
+		t.Errorf("Unexpected number of connections=%d, expected=2", n)
+	}
+
+	// Reconnect after the agent drops the connections
+	agent.closeConns()
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+			t.Fatalf("PreRequest after agent restart failed: %s", err)
+		}
+	}
+	if n := agent.Accepted(); n != 4 {
+		t.Errorf("Unexpected number of connections=%d, expected=4", n)
+	}
+}
+
+func TestRPCInspectorMultiplexTimeout(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network:        "unix",
+		Address:        agent.ln.Addr().String(),
+		Timeout:        20 * time.Millisecond,
+		MultiplexConns: 1,
+	}
+	defer ri.Close()
+
+	agent.SetDelay(50 * time.Millisecond)
+	if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err == nil {
+		t.Fatalf("Expected PreRequest to time out")
+	}
+
+	// The timed out call must not have closed the shared connection
+	agent.SetDelay(0)
+	time.Sleep(50 * time.Millisecond)
+	if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+		t.Fatalf("PreRequest failed: %s", err)
+	}
+	if n := agent.Accepted(); n != 1 {
+		t.Errorf("Unexpected number of connections=%d, expected=1", n)
+	}
+}
+
+func TestRPCInspectorMultiplexWriteTimeout(t *testing.T) {
+	// A listener that never reads the requests
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "sigsci.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ri := &RPCInspector{
+		Network:        "unix",
+		Address:        ln.Addr().String(),
+		Timeout:        50 * time.Millisecond,
+		MultiplexConns: 1,
+	}
+	defer ri.Close()
+
+	// Large enough to fill the socket buffers, blocking the write
+	in := &RPCMsgIn{PostBody: string(make([]byte, 8<<20))}
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ri.PreRequest(in, &RPCMsgOut{}); err == nil {
+				t.Errorf("Expected PreRequest to time out")
+			}
+		}()
+	}
+	wg.Wait()
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("Timeout was not honored while writing, took %s", d)
+	}
+}
+
+func TestRPCInspectorMultiplexCancelWhileWriting(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network:        "unix",
+		Address:        agent.ln.Addr().String(),
+		Timeout:        5 * time.Second,
+		MultiplexConns: 1,
+	}
+	defer ri.Close()
+
+	// A large request takes a while to write, while other calls on the
+	// same connection are cancelled
+	big := make(chan error, 1)
+	go func() {
+		big <- ri.PreRequest(&RPCMsgIn{PostBody: string(make([]byte, 32<<20))}, &RPCMsgOut{})
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			defer cancel()
+			ri.PreRequestContext(ctx, &RPCMsgIn{}, &RPCMsgOut{})
+		}()
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+	if err := <-big; err != nil {
+		t.Fatalf("PreRequest failed: %s", err)
+	}
+	if n := agent.Accepted(); n != 1 {
+		t.Errorf("Unexpected number of connections=%d, expected=1", n)
+	}
+}
+
+func TestRPCInspectorFailover(t *testing.T) {
+	agent := newTestAgent(t)
+	down := filepath.Join(t.TempDir(), "down.sock")
+	ri := &RPCInspector{
+		Timeout: time.Second,
+		Endpoints: []RPCEndpoint{
+			{Network: "unix", Address: down},
+			{Network: "unix", Address: agent.ln.Addr().String()},
+		},
+		MaxIdleConns: 1,
+	}
+	defer ri.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+			t.Fatalf("call %d: PreRequest failed: %s", i, err)
+		}
+	}
+	if n := agent.Accepted(); n != 1 {
+		t.Errorf("Unexpected number of connections=%d, expected=1", n)
+	}
+
+	// The failed endpoint is avoided
+	eps := ri.getBalancer().order()
+	if eps[0].Address != agent.ln.Addr().String() {
+		t.Errorf("Unexpected first endpoint %s", eps[0])
+	}
+}
+
+func TestRPCInspectorRoundRobin(t *testing.T) {
+	agent1 := newTestAgent(t)
+	agent2 := newTestAgent(t)
+	ri := &RPCInspector{
+		Timeout: time.Second,
+		Endpoints: []RPCEndpoint{
+			{Network: "unix", Address: agent1.ln.Addr().String()},
+			{Network: "unix", Address: agent2.ln.Addr().String()},
+		},
+		Balance: BalanceRoundRobin,
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+			t.Fatalf("call %d: PreRequest failed: %s", i, err)
+		}
+	}
+	if n1, n2 := agent1.Accepted(), agent2.Accepted(); n1 != 5 || n2 != 5 {
+		t.Errorf("Unexpected number of connections=%d/%d, expected=5/5", n1, n2)
+	}
+}
+
+func TestRPCInspectorLeastLatency(t *testing.T) {
+	slow := newTestAgent(t)
+	slow.SetDelay(20 * time.Millisecond)
+	fast := newTestAgent(t)
+	ri := &RPCInspector{
+		Timeout: time.Second,
+		Endpoints: []RPCEndpoint{
+			{Network: "unix", Address: slow.ln.Addr().String()},
+			{Network: "unix", Address: fast.ln.Addr().String()},
+		},
+		Balance: BalanceLeastLatency,
+	}
+
+	// Measure both endpoints
+	for _, ep := range ri.getBalancer().endpoints {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		start := time.Now()
+		err := ep.call(ctx, "RPC.PreRequest", &RPCMsgIn{}, &RPCMsgOut{}, 0)
+		cancel()
+		if err != nil {
+			t.Fatalf("PreRequest to %s failed: %s", ep, err)
+		}
+		ep.success(time.Since(start))
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+			t.Fatalf("call %d: PreRequest failed: %s", i, err)
+		}
+	}
+	if n1, n2 := slow.Accepted(), fast.Accepted(); n1 != 1 || n2 != 6 {
+		t.Errorf("Unexpected number of connections=%d/%d, expected=1/6", n1, n2)
+	}
+}
+
+// genTestCert generates a self-signed certificate for 127.0.0.1 usable
+// as a CA, server and client certificate
+func genTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sigsci-agent"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %s", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+func TestRPCInspectorTLS(t *testing.T) {
+	cert, pool := genTestCert(t)
+	agent := newTLSTestAgent(t, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+
+	cases := []struct {
+		config *tls.Config
+		valid  bool
+	}{
+		// mTLS
+		{&tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}}, true},
+		// Missing client certificate
+		{&tls.Config{RootCAs: pool}, false},
+		// Unknown CA
+		{&tls.Config{Certificates: []tls.Certificate{cert}}, false},
+		// Wrong server name
+		{&tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}, ServerName: "agent.example.com"}, false},
+	}
+	for pos, tt := range cases {
+		ri := &RPCInspector{
+			Network:   "tcp",
+			Address:   agent.ln.Addr().String(),
+			Timeout:   time.Second,
+			TLSConfig: tt.config,
+		}
+		err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{})
+		if (err == nil) != tt.valid {
+			t.Errorf("test %d: unexpected error: %v", pos, err)
+		}
+	}
+}
+
+func TestRPCInspectorContextCancel(t *testing.T) {
+	agent := newTestAgent(t)
+	agent.SetDelay(time.Second)
+	for _, tc := range []struct {
+		name string
+		ri   *RPCInspector
+	}{
+		{"dial", &RPCInspector{}},
+		{"pool", &RPCInspector{MaxIdleConns: 1}},
+		{"multiplex", &RPCInspector{MultiplexConns: 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ri := tc.ri
+			ri.Network = "unix"
+			ri.Address = agent.ln.Addr().String()
+			ri.Timeout = 5 * time.Second
+			defer ri.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			start := time.Now()
+			err := ri.PreRequestContext(ctx, &RPCMsgIn{}, &RPCMsgOut{})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if d := time.Since(start); d >= time.Second {
+				t.Errorf("Call was not cancelled, took %s", d)
+			}
+			if !ri.getBalancer().endpoints[0].available(time.Now()) {
+				t.Error("Endpoint marked as failed after cancellation")
+			}
+		})
+	}
+}
+
+func TestRPCInspectorContextDeadline(t *testing.T) {
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network: "unix",
+		Address: agent.ln.Addr().String(),
+		Timeout: 5 * time.Second,
+	}
+	defer ri.Close()
+
+	// The context deadline is sooner than the Timeout
+	agent.SetDelay(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := ri.PreRequestContext(ctx, &RPCMsgIn{}, &RPCMsgOut{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("Context deadline was not honored, took %s", d)
+	}
+
+	// The Timeout is sooner than the context deadline
+	ri.Timeout = 50 * time.Millisecond
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start = time.Now()
+	if err := ri.PreRequestContext(ctx, &RPCMsgIn{}, &RPCMsgOut{}); err == nil {
+		t.Fatal("Expected a timeout error")
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("Timeout was not honored, took %s", d)
+	}
+
+	// An unlimited context works as before
+	agent.SetDelay(0)
+	ri.Timeout = time.Second
+	out := RPCMsgOut{}
+	if err := ri.PreRequestContext(context.Background(), &RPCMsgIn{}, &out); err != nil {
+		t.Fatalf("PreRequest failed: %s", err)
+	}
+	if out.WAFResponse != 200 {
+		t.Errorf("Unexpected WAFResponse=%d", out.WAFResponse)
+	}
+}
+
+func TestRPCInspectorReportTimeout(t *testing.T) {
+	agent := newTestAgent(t)
+	agent.SetDelay(100 * time.Millisecond)
+	ri := &RPCInspector{
+		Network:       "unix",
+		Address:       agent.ln.Addr().String(),
+		Timeout:       20 * time.Millisecond,
+		ReportTimeout: 5 * time.Second,
+	}
+	defer ri.Close()
+
+	if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err == nil {
+		t.Fatal("Expected PreRequest to time out")
+	}
+	if err := ri.PostRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+		t.Errorf("PostRequest failed: %s", err)
+	}
+	if err := ri.UpdateRequest(&RPCMsgIn2{}, &RPCMsgOut{}); err != nil {
+		t.Errorf("UpdateRequest failed: %s", err)
+	}
+}
+
+func TestRPCInspectorDialTimeout(t *testing.T) {
+	// A listener that never completes the TLS handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ri := &RPCInspector{
+		Network:     "tcp",
+		Address:     ln.Addr().String(),
+		Timeout:     5 * time.Second,
+		DialTimeout: 20 * time.Millisecond,
+		TLSConfig:   &tls.Config{InsecureSkipVerify: true},
+	}
+	defer ri.Close()
+
+	start := time.Now()
+	if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err == nil {
+		t.Fatal("Expected PreRequest to fail")
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("Dial timeout was not honored, took %s", d)
+	}
+	if _, err := ri.GetRPCClient(); err == nil {
+		t.Fatal("Expected GetRPCClient to fail")
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("Dial timeout was not honored, took %s", d)
+	}
+}
+
+// slowHandshakeListener delays the TLS handshake of each accepted connection
+type slowHandshakeListener struct {
+	net.Listener
+	delay time.Duration
+}
+
+func (ln slowHandshakeListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err == nil {
+		time.Sleep(ln.delay)
+	}
+	return conn, err
+}
+
+func TestRPCInspectorDialThenTimeout(t *testing.T) {
+	cert, pool := genTestCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	agent := newTestAgentListener(t, slowHandshakeListener{ln, 40 * time.Millisecond})
+	agent.SetDelay(40 * time.Millisecond)
+
+	// Connecting and the call each take less than their own timeout, but
+	// more than the Timeout together
+	cases := []struct {
+		name string
+		ri   *RPCInspector
+	}{
+		{"per call", &RPCInspector{}},
+		{"pool", &RPCInspector{MaxIdleConns: 1}},
+		{"multiplex", &RPCInspector{MultiplexConns: 1}},
+	}
+	for _, tt := range cases {
+		ri := tt.ri
+		ri.Network = "tcp"
+		ri.Address = ln.Addr().String()
+		ri.TLSConfig = &tls.Config{RootCAs: pool}
+		ri.Timeout = 60 * time.Millisecond
+		ri.DialTimeout = time.Second
+		if err := ri.PreRequest(&RPCMsgIn{}, &RPCMsgOut{}); err != nil {
+			t.Errorf("%s: PreRequest failed: %s", tt.name, err)
+		}
+		ri.Close()
+	}
+}
+
+func TestRPCInspectorBatch(t *testing.T) {
+	batch := &RPCMsgBatch{
+		PostRequests:   []RPCMsgIn{{Method: "GET"}, {Method: "POST"}},
+		UpdateRequests: []RPCMsgIn2{{RequestID: "0123456789abcdef01234567"}},
+	}
+
+	agent := newTestAgent(t)
+	ri := &RPCInspector{
+		Network: "unix",
+		Address: agent.ln.Addr().String(),
+		Timeout: time.Second,
+	}
+	defer ri.Close()
+	if err := ri.BatchRequest(batch, &RPCMsgOut{}); err != nil {
+		t.Fatalf("BatchRequest failed: %s", err)
+	}
+	if n := agent.Calls("RPC.BatchRequest"); n != 1 {
+		t.Errorf("Unexpected RPC.BatchRequest calls=%d, expected=1", n)
+	}
+	if n := agent.Calls("RPC.PostRequest") + agent.Calls("RPC.UpdateRequest"); n != 0 {
+		t.Errorf("Unexpected individual calls=%d, expected=0", n)
+	}
+
+	// An agent without batch support gets individual calls
+	old := newTestAgent(t)
+	old.noBatch = true
+	ri = &RPCInspector{
+		Network: "unix",
+		Address: old.ln.Addr().String(),
+		Timeout: time.Second,
+	}
+	defer ri.Close()
+	for i := 0; i < 2; i++ {
+		if err := ri.BatchRequest(batch, &RPCMsgOut{}); err != nil {
+			t.Fatalf("BatchRequest failed: %s", err)
+		}
+	}
+	if n := old.Calls("RPC.BatchRequest"); n != 1 {
+		t.Errorf("Unexpected RPC.BatchRequest calls=%d, expected=1", n)
+	}
+	if n := old.Calls("RPC.PostRequest"); n != 4 {
+		t.Errorf("Unexpected RPC.PostRequest calls=%d, expected=4", n)
+	}
+	if n := old.Calls("RPC.UpdateRequest"); n != 2 {
+		t.Errorf("Unexpected RPC.UpdateRequest calls=%d, expected=2", n)
+	}
+}
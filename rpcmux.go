@@ -0,0 +1,165 @@
+package sigsci
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errCallTimeout is returned when a multiplexed call does not complete in time
+var errCallTimeout = errors.New("call timed out waiting for a reply")
+
+// muxClient is a long-lived RPC client shared by concurrent calls,
+// which are multiplexed over a single connection by sequence ID
+type muxClient struct {
+	dial func(ctx context.Context) (net.Conn, error)
+	// writeTimeout bounds writing each request, so that an agent that
+	// stops reading does not block the calls sharing the connection
+	writeTimeout time.Duration
+
+	mu     sync.Mutex
+	client *rpc.Client
+	closed bool
+}
+
+// get returns the shared client, connecting to the agent if required
+func (mc *muxClient) get(ctx context.Context) (*rpc.Client, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		return nil, rpc.ErrShutdown
+	}
+	if mc.client != nil {
+		return mc.client, nil
+	}
+
+	conn, err := mc.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mc.client = rpc.NewClientWithCodec(newMsgpClientCodecTimeout(conn, mc.writeTimeout))
+	return mc.client, nil
+}
+
+// reset closes the given client if it is still the shared client so that
+// the next call reconnects
+func (mc *muxClient) reset(client *rpc.Client) {
+	mc.mu.Lock()
+	if mc.client == client {
+		mc.client = nil
+	}
+	mc.mu.Unlock()
+	client.Close()
+}
+
+func (mc *muxClient) close() error {
+	mc.mu.Lock()
+	client := mc.client
+	mc.client = nil
+	mc.closed = true
+	mc.mu.Unlock()
+	if client != nil {
+		return client.Close()
+	}
+	return nil
+}
+
+// muxClients balances calls across a fixed number of shared clients
+type muxClients struct {
+	clients []*muxClient
+	next    uint32
+}
+
+func newMuxClients(dial func(context.Context) (net.Conn, error), n int, writeTimeout time.Duration) *muxClients {
+	m := &muxClients{clients: make([]*muxClient, n)}
+	for i := range m.clients {
+		m.clients[i] = &muxClient{dial: dial, writeTimeout: writeTimeout}
+	}
+	return m
+}
+
+// pick returns the next shared client in round-robin order
+func (m *muxClients) pick() *muxClient {
+	n := atomic.AddUint32(&m.next, 1)
+	return m.clients[n%uint32(len(m.clients))]
+}
+
+// flush closes the shared clients so that new connections are made
+func (m *muxClients) flush() {
+	for _, mc := range m.clients {
+		mc.mu.Lock()
+		client := mc.client
+		mc.client = nil
+		mc.mu.Unlock()
+		if client != nil {
+			client.Close()
+		}
+	}
+}
+
+func (m *muxClients) close() error {
+	for _, mc := range m.clients {
+		mc.close()
+	}
+	return nil
+}
+
+// call makes a call on a shared client. The context being done only
+// abandons this call, leaving the connection intact for other calls and
+// for a late reply.
+func (m *muxClients) call(ctx context.Context, method string, in, out interface{}, timeout time.Duration) error {
+	mc := m.pick()
+	for retried := false; ; retried = true {
+		client, err := mc.get(ctx)
+		if err != nil {
+			return err
+		}
+
+		cctx, cancel := withCallTimeout(ctx, timeout)
+		call, err := goContext(cctx, client, method, in, out)
+		cancel()
+		if err == context.DeadlineExceeded {
+			return errCallTimeout
+		} else if err != nil {
+			return err
+		}
+
+		switch call.Error.(type) {
+		case nil, rpc.ServerError:
+			return call.Error
+		}
+
+		// The connection failed (e.g., the agent restarted), so
+		// reconnect and retry once on a fresh connection
+		mc.reset(client)
+		if call.Error == rpc.ErrShutdown && !retried {
+			continue
+		}
+		return call.Error
+	}
+}
+
+// goContext makes a call on the client, waiting until either the call
+// completes or the context is done. The reply is decoded into a private
+// value that is only copied to out on success, so that a reply arriving
+// after the context is done does not race with the caller using out. If
+// the context error is returned, the call is still in flight.
+func goContext(ctx context.Context, client *rpc.Client, method string, in, out interface{}) (*rpc.Call, error) {
+	reply := reflect.New(reflect.TypeOf(out).Elem())
+	call := client.Go(method, in, reply.Interface(), make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		return call, ctx.Err()
+	}
+	if call.Error == nil {
+		reflect.ValueOf(out).Elem().Set(reply.Elem())
+	}
+	return call, nil
+}
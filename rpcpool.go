@@ -0,0 +1,232 @@
+package sigsci
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// pooledClient is a long-lived RPC client along with its underlying connection
+type pooledClient struct {
+	conn     net.Conn
+	client   *rpc.Client
+	lastUsed time.Time
+	reused   bool
+}
+
+// connPool is a pool of idle RPC clients to the agent so that each
+// call does not have to pay for dialing a new connection
+type connPool struct {
+	dial        func(ctx context.Context) (net.Conn, error)
+	minIdle     int
+	maxIdle     int
+	idleTimeout time.Duration
+	fillTimeout time.Duration
+
+	mu      sync.Mutex
+	idle    []*pooledClient // LIFO so that the most recently used are reused first
+	closed  bool
+	filling bool
+}
+
+func newConnPool(dial func(context.Context) (net.Conn, error), minIdle, maxIdle int, idleTimeout, fillTimeout time.Duration) *connPool {
+	if minIdle > maxIdle {
+		minIdle = maxIdle
+	}
+	return &connPool{
+		dial:        dial,
+		minIdle:     minIdle,
+		maxIdle:     maxIdle,
+		idleTimeout: idleTimeout,
+		fillTimeout: fillTimeout,
+	}
+}
+
+// get returns an idle client from the pool or dials a new one
+func (p *connPool) get(ctx context.Context) (*pooledClient, error) {
+	p.mu.Lock()
+	p.evictExpiredLocked(time.Now())
+	if n := len(p.idle); n > 0 {
+		pc := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		pc.reused = true
+		return pc, nil
+	}
+	p.mu.Unlock()
+
+	return p.newClient(ctx)
+}
+
+// put returns a client to the pool. The client is closed instead if the
+// call failed, as the connection state is then unknown, or if the pool is full.
+// Errors returned by the agent itself do not affect the connection.
+func (p *connPool) put(pc *pooledClient, err error) {
+	if _, ok := err.(rpc.ServerError); ok {
+		// The agent replied with an error, so the connection is still healthy
+		err = nil
+	}
+	if err == nil {
+		// Clear the per-call deadline so the idle connection is not torn down
+		err = pc.conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		pc.client.Close()
+		// Replace the client if the pool is now below minIdle
+		p.refill()
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= p.maxIdle {
+		p.mu.Unlock()
+		pc.client.Close()
+		return
+	}
+	pc.lastUsed = time.Now()
+	p.idle = append(p.idle, pc)
+	p.mu.Unlock()
+}
+
+// call makes a call on a pooled client, which must complete before the
+// context is done. This includes the time to connect to the agent if a
+// new connection is required.
+func (p *connPool) call(ctx context.Context, method string, in, out interface{}, timeout time.Duration) error {
+	for {
+		pc, err := p.get(ctx)
+		if err != nil {
+			return err
+		}
+		cctx, cancel := withCallTimeout(ctx, timeout)
+		err = callConn(cctx, pc.conn, pc.client, method, in, out)
+		cancel()
+		p.put(pc, err)
+
+		// An idle connection may have been closed by the agent, so
+		// retry if that is why the call failed
+		if err == rpc.ErrShutdown && pc.reused {
+			continue
+		}
+		return err
+	}
+}
+
+// flush closes all idle clients so that new connections are made,
+// dialing minIdle new connections in the background
+func (p *connPool) flush() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		pc.client.Close()
+	}
+	p.refill()
+}
+
+// refill fills the pool in the background if there are fewer than minIdle
+// idle clients. Only one fill is run at a time.
+func (p *connPool) refill() {
+	p.mu.Lock()
+	start := !p.closed && !p.filling && len(p.idle) < p.minIdle
+	if start {
+		p.filling = true
+	}
+	p.mu.Unlock()
+	if !start {
+		return
+	}
+
+	go func() {
+		p.fill()
+		p.mu.Lock()
+		p.filling = false
+		p.mu.Unlock()
+	}()
+}
+
+// fill dials new connections until there are at least minIdle idle
+// clients, giving up if the agent cannot be reached within fillTimeout
+func (p *connPool) fill() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.fillTimeout)
+	defer cancel()
+
+	for {
+		p.mu.Lock()
+		n := len(p.idle)
+		closed := p.closed
+		p.mu.Unlock()
+		if closed || n >= p.minIdle {
+			return
+		}
+
+		pc, err := p.newClient(ctx)
+		if err != nil {
+			return
+		}
+		p.put(pc, nil)
+	}
+}
+
+// close closes all idle clients and stops any further pooling
+func (p *connPool) close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.flush()
+	return nil
+}
+
+func (p *connPool) newClient(ctx context.Context) (*pooledClient, error) {
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledClient{
+		conn:   conn,
+		client: rpc.NewClientWithCodec(NewMsgpClientCodec(conn)),
+	}, nil
+}
+
+// evictExpiredLocked closes clients that have been idle for too long,
+// keeping at least minIdle clients around
+func (p *connPool) evictExpiredLocked(now time.Time) {
+	if p.idleTimeout <= 0 {
+		return
+	}
+	// The oldest clients are at the front of the idle list
+	n := 0
+	for n < len(p.idle)-p.minIdle && now.Sub(p.idle[n].lastUsed) > p.idleTimeout {
+		p.idle[n].client.Close()
+		n++
+	}
+	if n > 0 {
+		p.idle = append(p.idle[:0], p.idle[n:]...)
+	}
+}
+
+// callConn makes a call on a client that owns the connection, with the
+// context deadline as the connection deadline. The connection is
+// interrupted if the context is done before the call completes.
+func callConn(ctx context.Context, conn net.Conn, client *rpc.Client, method string, in, out interface{}) error {
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		// Unblock the call by expiring the deadline immediately
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	err := client.Call(method, in, out)
+	if !stop() && err == nil {
+		// The connection was interrupted just as the call completed
+		// so the connection is now unusable
+		err = ctx.Err()
+	}
+	return err
+}
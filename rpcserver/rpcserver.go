@@ -0,0 +1,113 @@
+// Package rpcserver implements the agent side of the msgpack RPC protocol
+// used by the module, so that Go programs can serve the calls made by a
+// module (e.g., stand-in agents for tests, or protocol proxies).
+package rpcserver
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+
+	sigsci "github.com/signalsciences/sigsci-module-golang"
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// Handler handles the calls made by a module. The methods match the
+// sigsci.Inspector interface, so an Inspector can be used as a Handler.
+type Handler interface {
+	// ModuleInit is called when a module starts up
+	ModuleInit(*schema.RPCMsgIn, *schema.RPCMsgOut) error
+	// PreRequest is called before the request is processed by the app
+	PreRequest(*schema.RPCMsgIn, *schema.RPCMsgOut) error
+	// PostRequest is called after the request has been processed by the
+	// app, if there was not a `RequestID` returned by the PreRequest call.
+	// The output is only sent to the module if it has a response (see
+	// schema.RPCReportOut), which must only be set for modules that the
+	// handler enabled schema.CapReportResponse for in ModuleInit.
+	PostRequest(*schema.RPCMsgIn, *schema.RPCMsgOut) error
+	// UpdateRequest is called after the request has been processed by the
+	// app, if there was a `RequestID` returned by the PreRequest call. The
+	// output is sent to the module as for PostRequest.
+	UpdateRequest(*schema.RPCMsgIn2, *schema.RPCMsgOut) error
+}
+
+// BatchHandler is a Handler that also handles batches of reports. If the
+// Handler is not a BatchHandler, then modules fall back to sending the
+// reports individually.
+type BatchHandler interface {
+	Handler
+
+	// BatchRequest is called with a batch of PostRequest and UpdateRequest
+	// reports. The output is not sent to the module.
+	BatchRequest(*schema.RPCMsgBatch, *schema.RPCMsgOut) error
+}
+
+// Server serves the calls made by modules to a Handler
+type Server struct {
+	rpc *rpc.Server
+}
+
+// NewServer returns a server for the handler
+func NewServer(h Handler) *Server {
+	s := &Server{rpc: rpc.NewServer()}
+	if bh, ok := h.(BatchHandler); ok {
+		s.rpc.RegisterName("RPC", &batchService{service{bh}, bh})
+	} else {
+		s.rpc.RegisterName("RPC", &service{h})
+	}
+	return s
+}
+
+// Serve accepts connections on the listener, serving each connection in
+// a new goroutine, until the listener is closed
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection until the module disconnects
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	s.rpc.ServeCodec(sigsci.NewMsgpServerCodec(conn))
+}
+
+// service is registered as the "RPC" service, adapting the handler to the
+// replies expected by modules
+type service struct {
+	h Handler
+}
+
+// ModuleInit handles RPC.ModuleInit calls
+func (s *service) ModuleInit(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	return s.h.ModuleInit(in, out)
+}
+
+// PreRequest handles RPC.PreRequest calls
+func (s *service) PreRequest(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	return s.h.PreRequest(in, out)
+}
+
+// PostRequest handles RPC.PostRequest calls
+func (s *service) PostRequest(in *schema.RPCMsgIn, out *schema.RPCReportOut) error {
+	return s.h.PostRequest(in, &out.Out)
+}
+
+// UpdateRequest handles RPC.UpdateRequest calls
+func (s *service) UpdateRequest(in *schema.RPCMsgIn2, out *schema.RPCReportOut) error {
+	return s.h.UpdateRequest(in, &out.Out)
+}
+
+// batchService is the "RPC" service for a BatchHandler
+type batchService struct {
+	service
+	bh BatchHandler
+}
+
+// BatchRequest handles RPC.BatchRequest calls
+func (s *batchService) BatchRequest(in *schema.RPCMsgBatch, out *int) error {
+	return s.bh.BatchRequest(in, &schema.RPCMsgOut{})
+}
@@ -0,0 +1,221 @@
+package rpcserver
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sigsci "github.com/signalsciences/sigsci-module-golang"
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// testHandler records the calls made by the module
+type testHandler struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (h *testHandler) record(call string) {
+	h.mu.Lock()
+	h.calls = append(h.calls, call)
+	h.mu.Unlock()
+}
+
+func (h *testHandler) Calls() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.calls...)
+}
+
+func (h *testHandler) ModuleInit(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	h.record("ModuleInit " + in.ModuleVersion)
+	out.WAFResponse = 200
+	return nil
+}
+
+func (h *testHandler) PreRequest(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	h.record("PreRequest " + in.URI)
+	switch in.URI {
+	case "/error":
+		return errors.New("invalid request")
+	case "/maintenance":
+		out.WAFResponse = 200
+		out.Type = schema.EndRequest
+		out.StatusCode = 503
+		out.Header = []schema.Action{{Code: schema.SetHdr, Args: []string{"Retry-After", "120"}}}
+		out.Body = []byte("down for maintenance")
+		return nil
+	}
+	out.WAFResponse = 406
+	out.RequestID = "0123456789abcdef01234567"
+	out.RequestHeaders = [][2]string{{"X-Sigsci-Tags", "XSS"}}
+	return nil
+}
+
+func (h *testHandler) PostRequest(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	h.record("PostRequest " + in.URI)
+	if in.URI == "/flagged" {
+		out.RequestHeaders = [][2]string{{"X-Sigsci-Tags", "FLAGGED"}}
+	}
+	return nil
+}
+
+func (h *testHandler) UpdateRequest(in *schema.RPCMsgIn2, out *schema.RPCMsgOut) error {
+	h.record("UpdateRequest " + in.RequestID)
+	return nil
+}
+
+// testBatchHandler also handles batches
+type testBatchHandler struct {
+	testHandler
+}
+
+func (h *testBatchHandler) BatchRequest(in *schema.RPCMsgBatch, out *schema.RPCMsgOut) error {
+	h.record("BatchRequest")
+	return nil
+}
+
+// serve serves the handler on a unix socket, returning the address
+func serve(t *testing.T, h Handler) string {
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "sigsci.sock"))
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go NewServer(h).Serve(ln)
+	return ln.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	h := &testHandler{}
+	ri := &sigsci.RPCInspector{
+		Network:      "unix",
+		Address:      serve(t, h),
+		Timeout:      time.Second,
+		MaxIdleConns: 1,
+	}
+	defer ri.Close()
+
+	out := schema.RPCMsgOut{}
+	if err := ri.ModuleInit(&schema.RPCMsgIn{ModuleVersion: "test 1.0.0"}, &out); err != nil {
+		t.Fatalf("ModuleInit failed: %s", err)
+	}
+	out = schema.RPCMsgOut{}
+	if err := ri.PreRequest(&schema.RPCMsgIn{URI: "/"}, &out); err != nil {
+		t.Fatalf("PreRequest failed: %s", err)
+	}
+	if out.WAFResponse != 406 || out.RequestID != "0123456789abcdef01234567" || len(out.RequestHeaders) != 1 || out.RequestHeaders[0][1] != "XSS" {
+		t.Errorf("Unexpected PreRequest output: %+v", out)
+	}
+	out = schema.RPCMsgOut{}
+	if err := ri.PostRequest(&schema.RPCMsgIn{URI: "/missing"}, &out); err != nil {
+		t.Fatalf("PostRequest failed: %s", err)
+	}
+	if out.WAFResponse != 200 || out.HasReportResponse() {
+		t.Errorf("Unexpected PostRequest output: %+v", out)
+	}
+	if err := ri.PostRequest(&schema.RPCMsgIn{URI: "/flagged"}, &out); err != nil {
+		t.Fatalf("PostRequest failed: %s", err)
+	}
+	if out.WAFResponse != 200 || len(out.RequestHeaders) != 1 || out.RequestHeaders[0][1] != "FLAGGED" {
+		t.Errorf("Unexpected PostRequest output: %+v", out)
+	}
+	if err := ri.UpdateRequest(&schema.RPCMsgIn2{RequestID: "0123456789abcdef01234567"}, &schema.RPCMsgOut{}); err != nil {
+		t.Fatalf("UpdateRequest failed: %s", err)
+	}
+
+	// A handler error is a remote error, which leaves the connection usable
+	var serr rpc.ServerError
+	if err := ri.PreRequest(&schema.RPCMsgIn{URI: "/error"}, &schema.RPCMsgOut{}); !errors.As(err, &serr) {
+		t.Fatalf("Unexpected PreRequest error: %v", err)
+	}
+
+	// Without batch support, batches are sent as individual reports
+	batch := &schema.RPCMsgBatch{
+		PostRequests:   []schema.RPCMsgIn{{URI: "/batched"}},
+		UpdateRequests: []schema.RPCMsgIn2{{RequestID: "batched"}},
+	}
+	if err := ri.BatchRequest(batch, &schema.RPCMsgOut{}); err != nil {
+		t.Fatalf("BatchRequest failed: %s", err)
+	}
+
+	expected := []string{
+		"ModuleInit test 1.0.0",
+		"PreRequest /",
+		"PostRequest /missing",
+		"PostRequest /flagged",
+		"UpdateRequest 0123456789abcdef01234567",
+		"PreRequest /error",
+		"PostRequest /batched",
+		"UpdateRequest batched",
+	}
+	calls := h.Calls()
+	if len(calls) != len(expected) {
+		t.Fatalf("Unexpected calls %q, expected %q", calls, expected)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Unexpected call %d %q, expected %q", i, calls[i], expected[i])
+		}
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	h := &testBatchHandler{}
+	ri := &sigsci.RPCInspector{
+		Network:        "unix",
+		Address:        serve(t, h),
+		Timeout:        time.Second,
+		MultiplexConns: 1,
+	}
+	defer ri.Close()
+
+	batch := &schema.RPCMsgBatch{PostRequests: []schema.RPCMsgIn{{URI: "/batched"}}}
+	if err := ri.BatchRequest(batch, &schema.RPCMsgOut{}); err != nil {
+		t.Fatalf("BatchRequest failed: %s", err)
+	}
+	if calls := h.Calls(); len(calls) != 1 || calls[0] != "BatchRequest" {
+		t.Errorf("Unexpected calls %q", calls)
+	}
+}
+
+func TestServerLegacyReports(t *testing.T) {
+	conn, err := net.Dial("unix", serve(t, &testHandler{}))
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	client := rpc.NewClientWithCodec(sigsci.NewMsgpClientCodec(conn))
+	defer client.Close()
+
+	// A module predating report responses reads the reply as an integer
+	var reply int
+	if err := client.Call("RPC.PostRequest", &schema.RPCMsgIn{URI: "/missing"}, &reply); err != nil {
+		t.Fatalf("PostRequest failed: %s", err)
+	}
+	if err := client.Call("RPC.UpdateRequest", &schema.RPCMsgIn2{RequestID: "0123456789abcdef01234567"}, &reply); err != nil {
+		t.Fatalf("UpdateRequest failed: %s", err)
+	}
+}
+
+func TestServerEndRequest(t *testing.T) {
+	m, err := sigsci.NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }),
+		sigsci.Socket("unix", serve(t, &testHandler{})),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/maintenance", nil))
+	if w.Code != 503 || w.Header().Get("Retry-After") != "120" || w.Body.String() != "down for maintenance" {
+		t.Errorf("Unexpected response %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+}
@@ -0,0 +1,44 @@
+package schema
+
+import "github.com/tinylib/msgp/msgp"
+
+// RPCReportOut is the reply to a PostRequest or UpdateRequest report. An
+// agent replies with an RPCMsgOut if it has a response to the report (and
+// the ReportResponse capability is enabled), or with an integer otherwise,
+// which is how agents that predate the capability reply. An integer is
+// decoded as an empty output, and an output without a response is encoded
+// as an integer, so that it can be read by modules that predate the
+// capability.
+type RPCReportOut struct {
+	Out RPCMsgOut
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *RPCReportOut) DecodeMsg(dc *msgp.Reader) error {
+	t, err := dc.NextType()
+	if err != nil {
+		return msgp.WrapError(err, "Out")
+	}
+	z.Out = RPCMsgOut{}
+	if t != msgp.MapType {
+		return dc.Skip()
+	}
+	return z.Out.DecodeMsg(dc)
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *RPCReportOut) EncodeMsg(en *msgp.Writer) error {
+	if !z.Out.HasReportResponse() {
+		return en.WriteInt(0)
+	}
+	return z.Out.EncodeMsg(en)
+}
+
+// HasReportResponse returns true if the output is a response to a report,
+// i.e., it has anything other than a success WAFResponse
+func (z *RPCMsgOut) HasReportResponse() bool {
+	return (z.WAFResponse != 0 && z.WAFResponse != 200) ||
+		z.RequestID != "" ||
+		len(z.RequestHeaders) > 0 ||
+		len(z.RespActions) > 0
+}
@@ -29,6 +29,9 @@ type RPCMsgIn struct {
 	HeadersIn      [][2]string // HTTP Request headers (slice of name/value pairs); nil ok
 	HeadersOut     [][2]string // HTTP Response headers (slice of name/value pairs); nil ok
 	PostBody       string      // HTTP Request body; empty string if none
+
+	ProtocolVersion int32    `json:",omitempty" msg:",omitempty"` // ModuleInit only: capability exchange version
+	Capabilities    []string `json:",omitempty" msg:",omitempty"` // ModuleInit only: capabilities supported by the module
 }
 
 // RPCMsgOut is sent back to the webserver
@@ -37,19 +40,69 @@ type RPCMsgOut struct {
 	RequestID      string      `json:",omitempty"`                  // Set if the server expects an UpdateRequest with this ID (UUID)
 	RequestHeaders [][2]string `json:",omitempty"`                  // Any additional information in the form of additional request headers
 	RespActions    []Action    `json:",omitempty" msg:",omitempty"` // Add or Delete application response headers
+	ReqActions     []Action    `json:",omitempty" msg:",omitempty"` // PreRequest only: change the request before the application, if the ReqActions capability is enabled
+
+	ProtocolVersion int32        `json:",omitempty" msg:",omitempty"` // ModuleInit only: capability exchange version, 0 if not supported
+	Capabilities    []string     `json:",omitempty" msg:",omitempty"` // ModuleInit only: capabilities enabled by the agent
+	Config          *AgentConfig `json:",omitempty" msg:",omitempty"` // ModuleInit only: module configuration, if the ModuleConfig capability is enabled
+
+	Type       int      `json:",omitempty" msg:",omitempty"` // PreRequest only: response type (e.g., EndRequest), if its capability is enabled
+	StatusCode int      `json:",omitempty" msg:",omitempty"` // Response types only: response status
+	Header     []Action `json:",omitempty" msg:",omitempty"` // Response types only: response header actions
+	Body       []byte   `json:",omitempty" msg:",omitempty"` // Response types only: response body
+
+	DelayMillis int64 `json:",omitempty" msg:",omitempty"` // Tarpit and SlowResponse only: delay of the response
+}
+
+// ProtocolVersion is the version of the capability exchange made in the
+// ModuleInit call
+const ProtocolVersion int32 = 1
+
+// Capabilities exchanged in the ModuleInit call. The module sends the
+// capabilities it supports and the agent replies with the ones it enables,
+// which must be a subset. An agent that does not reply with a
+// ProtocolVersion predates the exchange.
+const (
+	CapEndRequest   = "EndRequest"   // EndRequest responses to PreRequest
+	CapRespActions  = "RespActions"  // Application response header actions
+	CapBatchRequest = "BatchRequest" // RPC.BatchRequest reports
+	CapModuleConfig = "ModuleConfig" // Module configuration from the agent
+
+	CapReportResponse = "ReportResponse" // Responses to PostRequest and UpdateRequest reports
 
-	Type       int      `msg:"-"` // rpc response type
-	StatusCode int      `msg:"-"` // write response with provided status
-	Header     []Action `msg:"-"` //  `json:",omitempty" msg:",omitempty"`
-	Body       []byte   `msg:"-"` //  `json:",omitempty" msg:",omitempty"`
+	CapTarpit         = "Tarpit"         // Tarpit responses to PreRequest
+	CapDropConnection = "DropConnection" // DropConnection responses to PreRequest
+	CapSlowResponse   = "SlowResponse"   // SlowResponse responses to PreRequest
+	CapReqActions     = "ReqActions"     // Request actions applied before the application
+)
+
+// AgentConfig is module configuration sent by the agent in reply to
+// ModuleInit, replacing any previous configuration from the agent. Unset
+// (zero) values leave the module's own configuration in place.
+type AgentConfig struct {
+	MaxContentLength      int64    `json:",omitempty" msg:",omitempty"` // Maximum request body length inspected
+	AnomalySize           int64    `json:",omitempty" msg:",omitempty"` // Response size reported as an anomaly
+	AnomalyDurationMillis int64    `json:",omitempty" msg:",omitempty"` // Response time reported as an anomaly
+	ExpectedContentTypes  []string `json:",omitempty" msg:",omitempty"` // Additional request body Content-Types inspected
 }
 
-// RPCMsgOut Type
+// RPCMsgOut Type. The types other than EndRequest end the request in the
+// same way, using the response (status, header and body) as described,
+// and are only used if the corresponding capability is enabled.
 const (
 	// End the request with the provided HTTP status, header, and body
 	EndRequest int = iota + 1
+	// Hold the request for DelayMillis before ending it
+	Tarpit
+	// Close the connection without a response, or end the request if the
+	// connection cannot be closed by itself (e.g., HTTP/2)
+	DropConnection
+	// End the request with the body written in parts over DelayMillis
+	SlowResponse
 )
 
+// Action codes for headers, which are the response headers in RespActions
+// and EndRequest responses and the request headers in ReqActions
 const (
 	AddHdr int8 = iota + 1
 	SetHdr
@@ -57,6 +110,14 @@ const (
 	DelHdr
 )
 
+// Action codes only used in ReqActions
+const (
+	SetQueryParam int8 = DelHdr + 1 + iota // Args: name, value
+	DelQueryParam                          // Args: name
+	RewritePath                            // Args: path
+	StripBody                              // No args
+)
+
 //msgp:tuple Action
 type Action struct {
 	Code int8
@@ -64,7 +125,7 @@ type Action struct {
 }
 
 // RPCMsgIn2 is a follow-up message from the webserver to the Agent
-// Note there is no formal response to this message
+// Note the response to this message is an RPCReportOut
 type RPCMsgIn2 struct {
 	RequestID      string // The request id (UUID)
 	ResponseCode   int32  // HTTP status code did the webserver send back
@@ -72,3 +133,11 @@ type RPCMsgIn2 struct {
 	ResponseSize   int64  // how many bytes did the webserver send back
 	HeadersOut     [][2]string
 }
+
+// RPCMsgBatch is a batch of reports from the webserver to the Agent, sent
+// in a single call instead of a PostRequest or UpdateRequest call each
+// Note there is no formal response to this message
+type RPCMsgBatch struct {
+	PostRequests   []RPCMsgIn  `json:",omitempty" msg:",omitempty"` // PostRequest messages
+	UpdateRequests []RPCMsgIn2 `json:",omitempty" msg:",omitempty"` // UpdateRequest messages
+}
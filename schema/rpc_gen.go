@@ -132,6 +132,552 @@ func (z *Action) Msgsize() (s int) {
 	return
 }
 
+// DecodeMsg implements msgp.Decodable
+func (z *AgentConfig) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "MaxContentLength":
+			z.MaxContentLength, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "MaxContentLength")
+				return
+			}
+		case "AnomalySize":
+			z.AnomalySize, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "AnomalySize")
+				return
+			}
+		case "AnomalyDurationMillis":
+			z.AnomalyDurationMillis, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "AnomalyDurationMillis")
+				return
+			}
+		case "ExpectedContentTypes":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "ExpectedContentTypes")
+				return
+			}
+			if cap(z.ExpectedContentTypes) >= int(zb0002) {
+				z.ExpectedContentTypes = (z.ExpectedContentTypes)[:zb0002]
+			} else {
+				z.ExpectedContentTypes = make([]string, zb0002)
+			}
+			for za0001 := range z.ExpectedContentTypes {
+				z.ExpectedContentTypes[za0001], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "ExpectedContentTypes", za0001)
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *AgentConfig) EncodeMsg(en *msgp.Writer) (err error) {
+	// check for omitted fields
+	zb0001Len := uint32(4)
+	var zb0001Mask uint8 /* 4 bits */
+	_ = zb0001Mask
+	if z.MaxContentLength == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x1
+	}
+	if z.AnomalySize == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x2
+	}
+	if z.AnomalyDurationMillis == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x4
+	}
+	if z.ExpectedContentTypes == nil {
+		zb0001Len--
+		zb0001Mask |= 0x8
+	}
+	// variable map header, size zb0001Len
+	err = en.Append(0x80 | uint8(zb0001Len))
+	if err != nil {
+		return
+	}
+
+	// skip if no fields are to be emitted
+	if zb0001Len != 0 {
+		if (zb0001Mask & 0x1) == 0 { // if not omitted
+			// write "MaxContentLength"
+			err = en.Append(0xb0, 0x4d, 0x61, 0x78, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt64(z.MaxContentLength)
+			if err != nil {
+				err = msgp.WrapError(err, "MaxContentLength")
+				return
+			}
+		}
+		if (zb0001Mask & 0x2) == 0 { // if not omitted
+			// write "AnomalySize"
+			err = en.Append(0xab, 0x41, 0x6e, 0x6f, 0x6d, 0x61, 0x6c, 0x79, 0x53, 0x69, 0x7a, 0x65)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt64(z.AnomalySize)
+			if err != nil {
+				err = msgp.WrapError(err, "AnomalySize")
+				return
+			}
+		}
+		if (zb0001Mask & 0x4) == 0 { // if not omitted
+			// write "AnomalyDurationMillis"
+			err = en.Append(0xb5, 0x41, 0x6e, 0x6f, 0x6d, 0x61, 0x6c, 0x79, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt64(z.AnomalyDurationMillis)
+			if err != nil {
+				err = msgp.WrapError(err, "AnomalyDurationMillis")
+				return
+			}
+		}
+		if (zb0001Mask & 0x8) == 0 { // if not omitted
+			// write "ExpectedContentTypes"
+			err = en.Append(0xb4, 0x45, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteArrayHeader(uint32(len(z.ExpectedContentTypes)))
+			if err != nil {
+				err = msgp.WrapError(err, "ExpectedContentTypes")
+				return
+			}
+			for za0001 := range z.ExpectedContentTypes {
+				err = en.WriteString(z.ExpectedContentTypes[za0001])
+				if err != nil {
+					err = msgp.WrapError(err, "ExpectedContentTypes", za0001)
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *AgentConfig) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// check for omitted fields
+	zb0001Len := uint32(4)
+	var zb0001Mask uint8 /* 4 bits */
+	_ = zb0001Mask
+	if z.MaxContentLength == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x1
+	}
+	if z.AnomalySize == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x2
+	}
+	if z.AnomalyDurationMillis == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x4
+	}
+	if z.ExpectedContentTypes == nil {
+		zb0001Len--
+		zb0001Mask |= 0x8
+	}
+	// variable map header, size zb0001Len
+	o = append(o, 0x80|uint8(zb0001Len))
+
+	// skip if no fields are to be emitted
+	if zb0001Len != 0 {
+		if (zb0001Mask & 0x1) == 0 { // if not omitted
+			// string "MaxContentLength"
+			o = append(o, 0xb0, 0x4d, 0x61, 0x78, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68)
+			o = msgp.AppendInt64(o, z.MaxContentLength)
+		}
+		if (zb0001Mask & 0x2) == 0 { // if not omitted
+			// string "AnomalySize"
+			o = append(o, 0xab, 0x41, 0x6e, 0x6f, 0x6d, 0x61, 0x6c, 0x79, 0x53, 0x69, 0x7a, 0x65)
+			o = msgp.AppendInt64(o, z.AnomalySize)
+		}
+		if (zb0001Mask & 0x4) == 0 { // if not omitted
+			// string "AnomalyDurationMillis"
+			o = append(o, 0xb5, 0x41, 0x6e, 0x6f, 0x6d, 0x61, 0x6c, 0x79, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+			o = msgp.AppendInt64(o, z.AnomalyDurationMillis)
+		}
+		if (zb0001Mask & 0x8) == 0 { // if not omitted
+			// string "ExpectedContentTypes"
+			o = append(o, 0xb4, 0x45, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x73)
+			o = msgp.AppendArrayHeader(o, uint32(len(z.ExpectedContentTypes)))
+			for za0001 := range z.ExpectedContentTypes {
+				o = msgp.AppendString(o, z.ExpectedContentTypes[za0001])
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *AgentConfig) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "MaxContentLength":
+			z.MaxContentLength, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "MaxContentLength")
+				return
+			}
+		case "AnomalySize":
+			z.AnomalySize, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "AnomalySize")
+				return
+			}
+		case "AnomalyDurationMillis":
+			z.AnomalyDurationMillis, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "AnomalyDurationMillis")
+				return
+			}
+		case "ExpectedContentTypes":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ExpectedContentTypes")
+				return
+			}
+			if cap(z.ExpectedContentTypes) >= int(zb0002) {
+				z.ExpectedContentTypes = (z.ExpectedContentTypes)[:zb0002]
+			} else {
+				z.ExpectedContentTypes = make([]string, zb0002)
+			}
+			for za0001 := range z.ExpectedContentTypes {
+				z.ExpectedContentTypes[za0001], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ExpectedContentTypes", za0001)
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *AgentConfig) Msgsize() (s int) {
+	s = 1 + 17 + msgp.Int64Size + 12 + msgp.Int64Size + 22 + msgp.Int64Size + 21 + msgp.ArrayHeaderSize
+	for za0001 := range z.ExpectedContentTypes {
+		s += msgp.StringPrefixSize + len(z.ExpectedContentTypes[za0001])
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *RPCMsgBatch) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "PostRequests":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "PostRequests")
+				return
+			}
+			if cap(z.PostRequests) >= int(zb0002) {
+				z.PostRequests = (z.PostRequests)[:zb0002]
+			} else {
+				z.PostRequests = make([]RPCMsgIn, zb0002)
+			}
+			for za0001 := range z.PostRequests {
+				err = z.PostRequests[za0001].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "PostRequests", za0001)
+					return
+				}
+			}
+		case "UpdateRequests":
+			var zb0003 uint32
+			zb0003, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "UpdateRequests")
+				return
+			}
+			if cap(z.UpdateRequests) >= int(zb0003) {
+				z.UpdateRequests = (z.UpdateRequests)[:zb0003]
+			} else {
+				z.UpdateRequests = make([]RPCMsgIn2, zb0003)
+			}
+			for za0002 := range z.UpdateRequests {
+				err = z.UpdateRequests[za0002].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "UpdateRequests", za0002)
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *RPCMsgBatch) EncodeMsg(en *msgp.Writer) (err error) {
+	// check for omitted fields
+	zb0001Len := uint32(2)
+	var zb0001Mask uint8 /* 2 bits */
+	_ = zb0001Mask
+	if z.PostRequests == nil {
+		zb0001Len--
+		zb0001Mask |= 0x1
+	}
+	if z.UpdateRequests == nil {
+		zb0001Len--
+		zb0001Mask |= 0x2
+	}
+	// variable map header, size zb0001Len
+	err = en.Append(0x80 | uint8(zb0001Len))
+	if err != nil {
+		return
+	}
+
+	// skip if no fields are to be emitted
+	if zb0001Len != 0 {
+		if (zb0001Mask & 0x1) == 0 { // if not omitted
+			// write "PostRequests"
+			err = en.Append(0xac, 0x50, 0x6f, 0x73, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteArrayHeader(uint32(len(z.PostRequests)))
+			if err != nil {
+				err = msgp.WrapError(err, "PostRequests")
+				return
+			}
+			for za0001 := range z.PostRequests {
+				err = z.PostRequests[za0001].EncodeMsg(en)
+				if err != nil {
+					err = msgp.WrapError(err, "PostRequests", za0001)
+					return
+				}
+			}
+		}
+		if (zb0001Mask & 0x2) == 0 { // if not omitted
+			// write "UpdateRequests"
+			err = en.Append(0xae, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteArrayHeader(uint32(len(z.UpdateRequests)))
+			if err != nil {
+				err = msgp.WrapError(err, "UpdateRequests")
+				return
+			}
+			for za0002 := range z.UpdateRequests {
+				err = z.UpdateRequests[za0002].EncodeMsg(en)
+				if err != nil {
+					err = msgp.WrapError(err, "UpdateRequests", za0002)
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *RPCMsgBatch) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// check for omitted fields
+	zb0001Len := uint32(2)
+	var zb0001Mask uint8 /* 2 bits */
+	_ = zb0001Mask
+	if z.PostRequests == nil {
+		zb0001Len--
+		zb0001Mask |= 0x1
+	}
+	if z.UpdateRequests == nil {
+		zb0001Len--
+		zb0001Mask |= 0x2
+	}
+	// variable map header, size zb0001Len
+	o = append(o, 0x80|uint8(zb0001Len))
+
+	// skip if no fields are to be emitted
+	if zb0001Len != 0 {
+		if (zb0001Mask & 0x1) == 0 { // if not omitted
+			// string "PostRequests"
+			o = append(o, 0xac, 0x50, 0x6f, 0x73, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73)
+			o = msgp.AppendArrayHeader(o, uint32(len(z.PostRequests)))
+			for za0001 := range z.PostRequests {
+				o, err = z.PostRequests[za0001].MarshalMsg(o)
+				if err != nil {
+					err = msgp.WrapError(err, "PostRequests", za0001)
+					return
+				}
+			}
+		}
+		if (zb0001Mask & 0x2) == 0 { // if not omitted
+			// string "UpdateRequests"
+			o = append(o, 0xae, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73)
+			o = msgp.AppendArrayHeader(o, uint32(len(z.UpdateRequests)))
+			for za0002 := range z.UpdateRequests {
+				o, err = z.UpdateRequests[za0002].MarshalMsg(o)
+				if err != nil {
+					err = msgp.WrapError(err, "UpdateRequests", za0002)
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *RPCMsgBatch) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "PostRequests":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "PostRequests")
+				return
+			}
+			if cap(z.PostRequests) >= int(zb0002) {
+				z.PostRequests = (z.PostRequests)[:zb0002]
+			} else {
+				z.PostRequests = make([]RPCMsgIn, zb0002)
+			}
+			for za0001 := range z.PostRequests {
+				bts, err = z.PostRequests[za0001].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "PostRequests", za0001)
+					return
+				}
+			}
+		case "UpdateRequests":
+			var zb0003 uint32
+			zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "UpdateRequests")
+				return
+			}
+			if cap(z.UpdateRequests) >= int(zb0003) {
+				z.UpdateRequests = (z.UpdateRequests)[:zb0003]
+			} else {
+				z.UpdateRequests = make([]RPCMsgIn2, zb0003)
+			}
+			for za0002 := range z.UpdateRequests {
+				bts, err = z.UpdateRequests[za0002].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "UpdateRequests", za0002)
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *RPCMsgBatch) Msgsize() (s int) {
+	s = 1 + 13 + msgp.ArrayHeaderSize
+	for za0001 := range z.PostRequests {
+		s += z.PostRequests[za0001].Msgsize()
+	}
+	s += 15 + msgp.ArrayHeaderSize
+	for za0002 := range z.UpdateRequests {
+		s += z.UpdateRequests[za0002].Msgsize()
+	}
+	return
+}
+
 // DecodeMsg implements msgp.Decodable
 func (z *RPCMsgIn) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
@@ -326,6 +872,31 @@ func (z *RPCMsgIn) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "PostBody")
 				return
 			}
+		case "ProtocolVersion":
+			z.ProtocolVersion, err = dc.ReadInt32()
+			if err != nil {
+				err = msgp.WrapError(err, "ProtocolVersion")
+				return
+			}
+		case "Capabilities":
+			var zb0006 uint32
+			zb0006, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Capabilities")
+				return
+			}
+			if cap(z.Capabilities) >= int(zb0006) {
+				z.Capabilities = (z.Capabilities)[:zb0006]
+			} else {
+				z.Capabilities = make([]string, zb0006)
+			}
+			for za0005 := range z.Capabilities {
+				z.Capabilities[za0005], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Capabilities", za0005)
+					return
+				}
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -339,244 +910,295 @@ func (z *RPCMsgIn) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *RPCMsgIn) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 21
-	// write "AccessKeyID"
-	err = en.Append(0xde, 0x0, 0x15, 0xab, 0x41, 0x63, 0x63, 0x65, 0x73, 0x73, 0x4b, 0x65, 0x79, 0x49, 0x44)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.AccessKeyID)
-	if err != nil {
-		err = msgp.WrapError(err, "AccessKeyID")
-		return
-	}
-	// write "ModuleVersion"
-	err = en.Append(0xad, 0x4d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.ModuleVersion)
-	if err != nil {
-		err = msgp.WrapError(err, "ModuleVersion")
-		return
-	}
-	// write "ServerVersion"
-	err = en.Append(0xad, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.ServerVersion)
-	if err != nil {
-		err = msgp.WrapError(err, "ServerVersion")
-		return
-	}
-	// write "ServerFlavor"
-	err = en.Append(0xac, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x46, 0x6c, 0x61, 0x76, 0x6f, 0x72)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.ServerFlavor)
-	if err != nil {
-		err = msgp.WrapError(err, "ServerFlavor")
-		return
-	}
-	// write "ServerName"
-	err = en.Append(0xaa, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.ServerName)
-	if err != nil {
-		err = msgp.WrapError(err, "ServerName")
-		return
-	}
-	// write "Timestamp"
-	err = en.Append(0xa9, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70)
-	if err != nil {
-		return
-	}
-	err = en.WriteInt64(z.Timestamp)
-	if err != nil {
-		err = msgp.WrapError(err, "Timestamp")
-		return
-	}
-	// write "NowMillis"
-	err = en.Append(0xa9, 0x4e, 0x6f, 0x77, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
-	if err != nil {
-		return
-	}
-	err = en.WriteInt64(z.NowMillis)
-	if err != nil {
-		err = msgp.WrapError(err, "NowMillis")
-		return
-	}
-	// write "RemoteAddr"
-	err = en.Append(0xaa, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x41, 0x64, 0x64, 0x72)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.RemoteAddr)
-	if err != nil {
-		err = msgp.WrapError(err, "RemoteAddr")
-		return
-	}
-	// write "Method"
-	err = en.Append(0xa6, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.Method)
-	if err != nil {
-		err = msgp.WrapError(err, "Method")
-		return
-	}
-	// write "Scheme"
-	err = en.Append(0xa6, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.Scheme)
-	if err != nil {
-		err = msgp.WrapError(err, "Scheme")
-		return
-	}
-	// write "URI"
-	err = en.Append(0xa3, 0x55, 0x52, 0x49)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.URI)
-	if err != nil {
-		err = msgp.WrapError(err, "URI")
-		return
-	}
-	// write "Protocol"
-	err = en.Append(0xa8, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.Protocol)
-	if err != nil {
-		err = msgp.WrapError(err, "Protocol")
-		return
-	}
-	// write "TLSProtocol"
-	err = en.Append(0xab, 0x54, 0x4c, 0x53, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.TLSProtocol)
-	if err != nil {
-		err = msgp.WrapError(err, "TLSProtocol")
-		return
-	}
-	// write "TLSCipher"
-	err = en.Append(0xa9, 0x54, 0x4c, 0x53, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.TLSCipher)
-	if err != nil {
-		err = msgp.WrapError(err, "TLSCipher")
-		return
-	}
-	// write "WAFResponse"
-	err = en.Append(0xab, 0x57, 0x41, 0x46, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65)
-	if err != nil {
-		return
-	}
-	err = en.WriteInt32(z.WAFResponse)
-	if err != nil {
-		err = msgp.WrapError(err, "WAFResponse")
-		return
-	}
-	// write "ResponseCode"
-	err = en.Append(0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65)
-	if err != nil {
-		return
-	}
-	err = en.WriteInt32(z.ResponseCode)
-	if err != nil {
-		err = msgp.WrapError(err, "ResponseCode")
-		return
-	}
-	// write "ResponseMillis"
-	err = en.Append(0xae, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
-	if err != nil {
-		return
-	}
-	err = en.WriteInt64(z.ResponseMillis)
-	if err != nil {
-		err = msgp.WrapError(err, "ResponseMillis")
-		return
-	}
-	// write "ResponseSize"
-	err = en.Append(0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x53, 0x69, 0x7a, 0x65)
-	if err != nil {
-		return
-	}
-	err = en.WriteInt64(z.ResponseSize)
-	if err != nil {
-		err = msgp.WrapError(err, "ResponseSize")
-		return
+	// check for omitted fields
+	zb0001Len := uint32(23)
+	var zb0001Mask uint32 /* 23 bits */
+	_ = zb0001Mask
+	if z.ProtocolVersion == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x200000
 	}
-	// write "HeadersIn"
-	err = en.Append(0xa9, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x49, 0x6e)
-	if err != nil {
-		return
+	if z.Capabilities == nil {
+		zb0001Len--
+		zb0001Mask |= 0x400000
 	}
-	err = en.WriteArrayHeader(uint32(len(z.HeadersIn)))
+	// variable map header, size zb0001Len
+	err = en.WriteMapHeader(zb0001Len)
 	if err != nil {
-		err = msgp.WrapError(err, "HeadersIn")
 		return
 	}
-	for za0001 := range z.HeadersIn {
-		err = en.WriteArrayHeader(uint32(2))
+
+	// skip if no fields are to be emitted
+	if zb0001Len != 0 {
+		// write "AccessKeyID"
+		err = en.Append(0xab, 0x41, 0x63, 0x63, 0x65, 0x73, 0x73, 0x4b, 0x65, 0x79, 0x49, 0x44)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.AccessKeyID)
+		if err != nil {
+			err = msgp.WrapError(err, "AccessKeyID")
+			return
+		}
+		// write "ModuleVersion"
+		err = en.Append(0xad, 0x4d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.ModuleVersion)
+		if err != nil {
+			err = msgp.WrapError(err, "ModuleVersion")
+			return
+		}
+		// write "ServerVersion"
+		err = en.Append(0xad, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.ServerVersion)
+		if err != nil {
+			err = msgp.WrapError(err, "ServerVersion")
+			return
+		}
+		// write "ServerFlavor"
+		err = en.Append(0xac, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x46, 0x6c, 0x61, 0x76, 0x6f, 0x72)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.ServerFlavor)
+		if err != nil {
+			err = msgp.WrapError(err, "ServerFlavor")
+			return
+		}
+		// write "ServerName"
+		err = en.Append(0xaa, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.ServerName)
+		if err != nil {
+			err = msgp.WrapError(err, "ServerName")
+			return
+		}
+		// write "Timestamp"
+		err = en.Append(0xa9, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt64(z.Timestamp)
+		if err != nil {
+			err = msgp.WrapError(err, "Timestamp")
+			return
+		}
+		// write "NowMillis"
+		err = en.Append(0xa9, 0x4e, 0x6f, 0x77, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt64(z.NowMillis)
+		if err != nil {
+			err = msgp.WrapError(err, "NowMillis")
+			return
+		}
+		// write "RemoteAddr"
+		err = en.Append(0xaa, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x41, 0x64, 0x64, 0x72)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.RemoteAddr)
+		if err != nil {
+			err = msgp.WrapError(err, "RemoteAddr")
+			return
+		}
+		// write "Method"
+		err = en.Append(0xa6, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
 		if err != nil {
-			err = msgp.WrapError(err, "HeadersIn", za0001)
 			return
 		}
-		for za0002 := range z.HeadersIn[za0001] {
-			err = en.WriteString(z.HeadersIn[za0001][za0002])
+		err = en.WriteString(z.Method)
+		if err != nil {
+			err = msgp.WrapError(err, "Method")
+			return
+		}
+		// write "Scheme"
+		err = en.Append(0xa6, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.Scheme)
+		if err != nil {
+			err = msgp.WrapError(err, "Scheme")
+			return
+		}
+		// write "URI"
+		err = en.Append(0xa3, 0x55, 0x52, 0x49)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.URI)
+		if err != nil {
+			err = msgp.WrapError(err, "URI")
+			return
+		}
+		// write "Protocol"
+		err = en.Append(0xa8, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.Protocol)
+		if err != nil {
+			err = msgp.WrapError(err, "Protocol")
+			return
+		}
+		// write "TLSProtocol"
+		err = en.Append(0xab, 0x54, 0x4c, 0x53, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.TLSProtocol)
+		if err != nil {
+			err = msgp.WrapError(err, "TLSProtocol")
+			return
+		}
+		// write "TLSCipher"
+		err = en.Append(0xa9, 0x54, 0x4c, 0x53, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.TLSCipher)
+		if err != nil {
+			err = msgp.WrapError(err, "TLSCipher")
+			return
+		}
+		// write "WAFResponse"
+		err = en.Append(0xab, 0x57, 0x41, 0x46, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt32(z.WAFResponse)
+		if err != nil {
+			err = msgp.WrapError(err, "WAFResponse")
+			return
+		}
+		// write "ResponseCode"
+		err = en.Append(0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt32(z.ResponseCode)
+		if err != nil {
+			err = msgp.WrapError(err, "ResponseCode")
+			return
+		}
+		// write "ResponseMillis"
+		err = en.Append(0xae, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt64(z.ResponseMillis)
+		if err != nil {
+			err = msgp.WrapError(err, "ResponseMillis")
+			return
+		}
+		// write "ResponseSize"
+		err = en.Append(0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x53, 0x69, 0x7a, 0x65)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt64(z.ResponseSize)
+		if err != nil {
+			err = msgp.WrapError(err, "ResponseSize")
+			return
+		}
+		// write "HeadersIn"
+		err = en.Append(0xa9, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x49, 0x6e)
+		if err != nil {
+			return
+		}
+		err = en.WriteArrayHeader(uint32(len(z.HeadersIn)))
+		if err != nil {
+			err = msgp.WrapError(err, "HeadersIn")
+			return
+		}
+		for za0001 := range z.HeadersIn {
+			err = en.WriteArrayHeader(uint32(2))
 			if err != nil {
-				err = msgp.WrapError(err, "HeadersIn", za0001, za0002)
+				err = msgp.WrapError(err, "HeadersIn", za0001)
 				return
 			}
+			for za0002 := range z.HeadersIn[za0001] {
+				err = en.WriteString(z.HeadersIn[za0001][za0002])
+				if err != nil {
+					err = msgp.WrapError(err, "HeadersIn", za0001, za0002)
+					return
+				}
+			}
 		}
-	}
-	// write "HeadersOut"
-	err = en.Append(0xaa, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x4f, 0x75, 0x74)
-	if err != nil {
-		return
-	}
-	err = en.WriteArrayHeader(uint32(len(z.HeadersOut)))
-	if err != nil {
-		err = msgp.WrapError(err, "HeadersOut")
-		return
-	}
-	for za0003 := range z.HeadersOut {
-		err = en.WriteArrayHeader(uint32(2))
+		// write "HeadersOut"
+		err = en.Append(0xaa, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x4f, 0x75, 0x74)
 		if err != nil {
-			err = msgp.WrapError(err, "HeadersOut", za0003)
 			return
 		}
-		for za0004 := range z.HeadersOut[za0003] {
-			err = en.WriteString(z.HeadersOut[za0003][za0004])
+		err = en.WriteArrayHeader(uint32(len(z.HeadersOut)))
+		if err != nil {
+			err = msgp.WrapError(err, "HeadersOut")
+			return
+		}
+		for za0003 := range z.HeadersOut {
+			err = en.WriteArrayHeader(uint32(2))
 			if err != nil {
-				err = msgp.WrapError(err, "HeadersOut", za0003, za0004)
+				err = msgp.WrapError(err, "HeadersOut", za0003)
 				return
 			}
+			for za0004 := range z.HeadersOut[za0003] {
+				err = en.WriteString(z.HeadersOut[za0003][za0004])
+				if err != nil {
+					err = msgp.WrapError(err, "HeadersOut", za0003, za0004)
+					return
+				}
+			}
+		}
+		// write "PostBody"
+		err = en.Append(0xa8, 0x50, 0x6f, 0x73, 0x74, 0x42, 0x6f, 0x64, 0x79)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.PostBody)
+		if err != nil {
+			err = msgp.WrapError(err, "PostBody")
+			return
+		}
+		if (zb0001Mask & 0x200000) == 0 { // if not omitted
+			// write "ProtocolVersion"
+			err = en.Append(0xaf, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt32(z.ProtocolVersion)
+			if err != nil {
+				err = msgp.WrapError(err, "ProtocolVersion")
+				return
+			}
+		}
+		if (zb0001Mask & 0x400000) == 0 { // if not omitted
+			// write "Capabilities"
+			err = en.Append(0xac, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteArrayHeader(uint32(len(z.Capabilities)))
+			if err != nil {
+				err = msgp.WrapError(err, "Capabilities")
+				return
+			}
+			for za0005 := range z.Capabilities {
+				err = en.WriteString(z.Capabilities[za0005])
+				if err != nil {
+					err = msgp.WrapError(err, "Capabilities", za0005)
+					return
+				}
+			}
 		}
-	}
-	// write "PostBody"
-	err = en.Append(0xa8, 0x50, 0x6f, 0x73, 0x74, 0x42, 0x6f, 0x64, 0x79)
-	if err != nil {
-		return
-	}
-	err = en.WriteString(z.PostBody)
-	if err != nil {
-		err = msgp.WrapError(err, "PostBody")
-		return
 	}
 	return
 }
@@ -584,82 +1206,112 @@ func (z *RPCMsgIn) EncodeMsg(en *msgp.Writer) (err error) {
 // MarshalMsg implements msgp.Marshaler
 func (z *RPCMsgIn) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 21
-	// string "AccessKeyID"
-	o = append(o, 0xde, 0x0, 0x15, 0xab, 0x41, 0x63, 0x63, 0x65, 0x73, 0x73, 0x4b, 0x65, 0x79, 0x49, 0x44)
-	o = msgp.AppendString(o, z.AccessKeyID)
-	// string "ModuleVersion"
-	o = append(o, 0xad, 0x4d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
-	o = msgp.AppendString(o, z.ModuleVersion)
-	// string "ServerVersion"
-	o = append(o, 0xad, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
-	o = msgp.AppendString(o, z.ServerVersion)
-	// string "ServerFlavor"
-	o = append(o, 0xac, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x46, 0x6c, 0x61, 0x76, 0x6f, 0x72)
-	o = msgp.AppendString(o, z.ServerFlavor)
-	// string "ServerName"
-	o = append(o, 0xaa, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65)
-	o = msgp.AppendString(o, z.ServerName)
-	// string "Timestamp"
-	o = append(o, 0xa9, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70)
-	o = msgp.AppendInt64(o, z.Timestamp)
-	// string "NowMillis"
-	o = append(o, 0xa9, 0x4e, 0x6f, 0x77, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
-	o = msgp.AppendInt64(o, z.NowMillis)
-	// string "RemoteAddr"
-	o = append(o, 0xaa, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x41, 0x64, 0x64, 0x72)
-	o = msgp.AppendString(o, z.RemoteAddr)
-	// string "Method"
-	o = append(o, 0xa6, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
-	o = msgp.AppendString(o, z.Method)
-	// string "Scheme"
-	o = append(o, 0xa6, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65)
-	o = msgp.AppendString(o, z.Scheme)
-	// string "URI"
-	o = append(o, 0xa3, 0x55, 0x52, 0x49)
-	o = msgp.AppendString(o, z.URI)
-	// string "Protocol"
-	o = append(o, 0xa8, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
-	o = msgp.AppendString(o, z.Protocol)
-	// string "TLSProtocol"
-	o = append(o, 0xab, 0x54, 0x4c, 0x53, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
-	o = msgp.AppendString(o, z.TLSProtocol)
-	// string "TLSCipher"
-	o = append(o, 0xa9, 0x54, 0x4c, 0x53, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72)
-	o = msgp.AppendString(o, z.TLSCipher)
-	// string "WAFResponse"
-	o = append(o, 0xab, 0x57, 0x41, 0x46, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65)
-	o = msgp.AppendInt32(o, z.WAFResponse)
-	// string "ResponseCode"
-	o = append(o, 0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65)
-	o = msgp.AppendInt32(o, z.ResponseCode)
-	// string "ResponseMillis"
-	o = append(o, 0xae, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
-	o = msgp.AppendInt64(o, z.ResponseMillis)
-	// string "ResponseSize"
-	o = append(o, 0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x53, 0x69, 0x7a, 0x65)
-	o = msgp.AppendInt64(o, z.ResponseSize)
-	// string "HeadersIn"
-	o = append(o, 0xa9, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x49, 0x6e)
-	o = msgp.AppendArrayHeader(o, uint32(len(z.HeadersIn)))
-	for za0001 := range z.HeadersIn {
-		o = msgp.AppendArrayHeader(o, uint32(2))
-		for za0002 := range z.HeadersIn[za0001] {
-			o = msgp.AppendString(o, z.HeadersIn[za0001][za0002])
-		}
+	// check for omitted fields
+	zb0001Len := uint32(23)
+	var zb0001Mask uint32 /* 23 bits */
+	_ = zb0001Mask
+	if z.ProtocolVersion == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x200000
 	}
-	// string "HeadersOut"
-	o = append(o, 0xaa, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x4f, 0x75, 0x74)
-	o = msgp.AppendArrayHeader(o, uint32(len(z.HeadersOut)))
-	for za0003 := range z.HeadersOut {
-		o = msgp.AppendArrayHeader(o, uint32(2))
-		for za0004 := range z.HeadersOut[za0003] {
-			o = msgp.AppendString(o, z.HeadersOut[za0003][za0004])
+	if z.Capabilities == nil {
+		zb0001Len--
+		zb0001Mask |= 0x400000
+	}
+	// variable map header, size zb0001Len
+	o = msgp.AppendMapHeader(o, zb0001Len)
+
+	// skip if no fields are to be emitted
+	if zb0001Len != 0 {
+		// string "AccessKeyID"
+		o = append(o, 0xab, 0x41, 0x63, 0x63, 0x65, 0x73, 0x73, 0x4b, 0x65, 0x79, 0x49, 0x44)
+		o = msgp.AppendString(o, z.AccessKeyID)
+		// string "ModuleVersion"
+		o = append(o, 0xad, 0x4d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+		o = msgp.AppendString(o, z.ModuleVersion)
+		// string "ServerVersion"
+		o = append(o, 0xad, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+		o = msgp.AppendString(o, z.ServerVersion)
+		// string "ServerFlavor"
+		o = append(o, 0xac, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x46, 0x6c, 0x61, 0x76, 0x6f, 0x72)
+		o = msgp.AppendString(o, z.ServerFlavor)
+		// string "ServerName"
+		o = append(o, 0xaa, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65)
+		o = msgp.AppendString(o, z.ServerName)
+		// string "Timestamp"
+		o = append(o, 0xa9, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70)
+		o = msgp.AppendInt64(o, z.Timestamp)
+		// string "NowMillis"
+		o = append(o, 0xa9, 0x4e, 0x6f, 0x77, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+		o = msgp.AppendInt64(o, z.NowMillis)
+		// string "RemoteAddr"
+		o = append(o, 0xaa, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x41, 0x64, 0x64, 0x72)
+		o = msgp.AppendString(o, z.RemoteAddr)
+		// string "Method"
+		o = append(o, 0xa6, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
+		o = msgp.AppendString(o, z.Method)
+		// string "Scheme"
+		o = append(o, 0xa6, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65)
+		o = msgp.AppendString(o, z.Scheme)
+		// string "URI"
+		o = append(o, 0xa3, 0x55, 0x52, 0x49)
+		o = msgp.AppendString(o, z.URI)
+		// string "Protocol"
+		o = append(o, 0xa8, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
+		o = msgp.AppendString(o, z.Protocol)
+		// string "TLSProtocol"
+		o = append(o, 0xab, 0x54, 0x4c, 0x53, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c)
+		o = msgp.AppendString(o, z.TLSProtocol)
+		// string "TLSCipher"
+		o = append(o, 0xa9, 0x54, 0x4c, 0x53, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72)
+		o = msgp.AppendString(o, z.TLSCipher)
+		// string "WAFResponse"
+		o = append(o, 0xab, 0x57, 0x41, 0x46, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65)
+		o = msgp.AppendInt32(o, z.WAFResponse)
+		// string "ResponseCode"
+		o = append(o, 0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x64, 0x65)
+		o = msgp.AppendInt32(o, z.ResponseCode)
+		// string "ResponseMillis"
+		o = append(o, 0xae, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+		o = msgp.AppendInt64(o, z.ResponseMillis)
+		// string "ResponseSize"
+		o = append(o, 0xac, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x53, 0x69, 0x7a, 0x65)
+		o = msgp.AppendInt64(o, z.ResponseSize)
+		// string "HeadersIn"
+		o = append(o, 0xa9, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x49, 0x6e)
+		o = msgp.AppendArrayHeader(o, uint32(len(z.HeadersIn)))
+		for za0001 := range z.HeadersIn {
+			o = msgp.AppendArrayHeader(o, uint32(2))
+			for za0002 := range z.HeadersIn[za0001] {
+				o = msgp.AppendString(o, z.HeadersIn[za0001][za0002])
+			}
+		}
+		// string "HeadersOut"
+		o = append(o, 0xaa, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x4f, 0x75, 0x74)
+		o = msgp.AppendArrayHeader(o, uint32(len(z.HeadersOut)))
+		for za0003 := range z.HeadersOut {
+			o = msgp.AppendArrayHeader(o, uint32(2))
+			for za0004 := range z.HeadersOut[za0003] {
+				o = msgp.AppendString(o, z.HeadersOut[za0003][za0004])
+			}
+		}
+		// string "PostBody"
+		o = append(o, 0xa8, 0x50, 0x6f, 0x73, 0x74, 0x42, 0x6f, 0x64, 0x79)
+		o = msgp.AppendString(o, z.PostBody)
+		if (zb0001Mask & 0x200000) == 0 { // if not omitted
+			// string "ProtocolVersion"
+			o = append(o, 0xaf, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+			o = msgp.AppendInt32(o, z.ProtocolVersion)
+		}
+		if (zb0001Mask & 0x400000) == 0 { // if not omitted
+			// string "Capabilities"
+			o = append(o, 0xac, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73)
+			o = msgp.AppendArrayHeader(o, uint32(len(z.Capabilities)))
+			for za0005 := range z.Capabilities {
+				o = msgp.AppendString(o, z.Capabilities[za0005])
+			}
 		}
 	}
-	// string "PostBody"
-	o = append(o, 0xa8, 0x50, 0x6f, 0x73, 0x74, 0x42, 0x6f, 0x64, 0x79)
-	o = msgp.AppendString(o, z.PostBody)
 	return
 }
 
@@ -857,6 +1509,31 @@ func (z *RPCMsgIn) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "PostBody")
 				return
 			}
+		case "ProtocolVersion":
+			z.ProtocolVersion, bts, err = msgp.ReadInt32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ProtocolVersion")
+				return
+			}
+		case "Capabilities":
+			var zb0006 uint32
+			zb0006, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Capabilities")
+				return
+			}
+			if cap(z.Capabilities) >= int(zb0006) {
+				z.Capabilities = (z.Capabilities)[:zb0006]
+			} else {
+				z.Capabilities = make([]string, zb0006)
+			}
+			for za0005 := range z.Capabilities {
+				z.Capabilities[za0005], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Capabilities", za0005)
+					return
+				}
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -885,7 +1562,10 @@ func (z *RPCMsgIn) Msgsize() (s int) {
 			s += msgp.StringPrefixSize + len(z.HeadersOut[za0003][za0004])
 		}
 	}
-	s += 9 + msgp.StringPrefixSize + len(z.PostBody)
+	s += 9 + msgp.StringPrefixSize + len(z.PostBody) + 16 + msgp.Int32Size + 13 + msgp.ArrayHeaderSize
+	for za0005 := range z.Capabilities {
+		s += msgp.StringPrefixSize + len(z.Capabilities[za0005])
+	}
 	return
 }
 
@@ -1276,6 +1956,167 @@ func (z *RPCMsgOut) DecodeMsg(dc *msgp.Reader) (err error) {
 					}
 				}
 			}
+		case "ReqActions":
+			var zb0007 uint32
+			zb0007, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "ReqActions")
+				return
+			}
+			if cap(z.ReqActions) >= int(zb0007) {
+				z.ReqActions = (z.ReqActions)[:zb0007]
+			} else {
+				z.ReqActions = make([]Action, zb0007)
+			}
+			for za0005 := range z.ReqActions {
+				var zb0008 uint32
+				zb0008, err = dc.ReadArrayHeader()
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005)
+					return
+				}
+				if zb0008 != 2 {
+					err = msgp.ArrayError{Wanted: 2, Got: zb0008}
+					return
+				}
+				z.ReqActions[za0005].Code, err = dc.ReadInt8()
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005, "Code")
+					return
+				}
+				var zb0009 uint32
+				zb0009, err = dc.ReadArrayHeader()
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005, "Args")
+					return
+				}
+				if cap(z.ReqActions[za0005].Args) >= int(zb0009) {
+					z.ReqActions[za0005].Args = (z.ReqActions[za0005].Args)[:zb0009]
+				} else {
+					z.ReqActions[za0005].Args = make([]string, zb0009)
+				}
+				for za0006 := range z.ReqActions[za0005].Args {
+					z.ReqActions[za0005].Args[za0006], err = dc.ReadString()
+					if err != nil {
+						err = msgp.WrapError(err, "ReqActions", za0005, "Args", za0006)
+						return
+					}
+				}
+			}
+		case "ProtocolVersion":
+			z.ProtocolVersion, err = dc.ReadInt32()
+			if err != nil {
+				err = msgp.WrapError(err, "ProtocolVersion")
+				return
+			}
+		case "Capabilities":
+			var zb0010 uint32
+			zb0010, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Capabilities")
+				return
+			}
+			if cap(z.Capabilities) >= int(zb0010) {
+				z.Capabilities = (z.Capabilities)[:zb0010]
+			} else {
+				z.Capabilities = make([]string, zb0010)
+			}
+			for za0007 := range z.Capabilities {
+				z.Capabilities[za0007], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Capabilities", za0007)
+					return
+				}
+			}
+		case "Config":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "Config")
+					return
+				}
+				z.Config = nil
+			} else {
+				if z.Config == nil {
+					z.Config = new(AgentConfig)
+				}
+				err = z.Config.DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Config")
+					return
+				}
+			}
+		case "Type":
+			z.Type, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "StatusCode":
+			z.StatusCode, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "StatusCode")
+				return
+			}
+		case "Header":
+			var zb0011 uint32
+			zb0011, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Header")
+				return
+			}
+			if cap(z.Header) >= int(zb0011) {
+				z.Header = (z.Header)[:zb0011]
+			} else {
+				z.Header = make([]Action, zb0011)
+			}
+			for za0008 := range z.Header {
+				var zb0012 uint32
+				zb0012, err = dc.ReadArrayHeader()
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008)
+					return
+				}
+				if zb0012 != 2 {
+					err = msgp.ArrayError{Wanted: 2, Got: zb0012}
+					return
+				}
+				z.Header[za0008].Code, err = dc.ReadInt8()
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008, "Code")
+					return
+				}
+				var zb0013 uint32
+				zb0013, err = dc.ReadArrayHeader()
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008, "Args")
+					return
+				}
+				if cap(z.Header[za0008].Args) >= int(zb0013) {
+					z.Header[za0008].Args = (z.Header[za0008].Args)[:zb0013]
+				} else {
+					z.Header[za0008].Args = make([]string, zb0013)
+				}
+				for za0009 := range z.Header[za0008].Args {
+					z.Header[za0008].Args[za0009], err = dc.ReadString()
+					if err != nil {
+						err = msgp.WrapError(err, "Header", za0008, "Args", za0009)
+						return
+					}
+				}
+			}
+		case "Body":
+			z.Body, err = dc.ReadBytes(z.Body)
+			if err != nil {
+				err = msgp.WrapError(err, "Body")
+				return
+			}
+		case "DelayMillis":
+			z.DelayMillis, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "DelayMillis")
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -1290,13 +2131,49 @@ func (z *RPCMsgOut) DecodeMsg(dc *msgp.Reader) (err error) {
 // EncodeMsg implements msgp.Encodable
 func (z *RPCMsgOut) EncodeMsg(en *msgp.Writer) (err error) {
 	// check for omitted fields
-	zb0001Len := uint32(4)
-	var zb0001Mask uint8 /* 4 bits */
+	zb0001Len := uint32(13)
+	var zb0001Mask uint16 /* 13 bits */
 	_ = zb0001Mask
 	if z.RespActions == nil {
 		zb0001Len--
 		zb0001Mask |= 0x8
 	}
+	if z.ReqActions == nil {
+		zb0001Len--
+		zb0001Mask |= 0x10
+	}
+	if z.ProtocolVersion == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x20
+	}
+	if z.Capabilities == nil {
+		zb0001Len--
+		zb0001Mask |= 0x40
+	}
+	if z.Config == nil {
+		zb0001Len--
+		zb0001Mask |= 0x80
+	}
+	if z.Type == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x100
+	}
+	if z.StatusCode == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x200
+	}
+	if z.Header == nil {
+		zb0001Len--
+		zb0001Mask |= 0x400
+	}
+	if z.Body == nil {
+		zb0001Len--
+		zb0001Mask |= 0x800
+	}
+	if z.DelayMillis == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x1000
+	}
 	// variable map header, size zb0001Len
 	err = en.Append(0x80 | uint8(zb0001Len))
 	if err != nil {
@@ -1385,6 +2262,176 @@ func (z *RPCMsgOut) EncodeMsg(en *msgp.Writer) (err error) {
 				}
 			}
 		}
+		if (zb0001Mask & 0x10) == 0 { // if not omitted
+			// write "ReqActions"
+			err = en.Append(0xaa, 0x52, 0x65, 0x71, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteArrayHeader(uint32(len(z.ReqActions)))
+			if err != nil {
+				err = msgp.WrapError(err, "ReqActions")
+				return
+			}
+			for za0005 := range z.ReqActions {
+				// array header, size 2
+				err = en.Append(0x92)
+				if err != nil {
+					return
+				}
+				err = en.WriteInt8(z.ReqActions[za0005].Code)
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005, "Code")
+					return
+				}
+				err = en.WriteArrayHeader(uint32(len(z.ReqActions[za0005].Args)))
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005, "Args")
+					return
+				}
+				for za0006 := range z.ReqActions[za0005].Args {
+					err = en.WriteString(z.ReqActions[za0005].Args[za0006])
+					if err != nil {
+						err = msgp.WrapError(err, "ReqActions", za0005, "Args", za0006)
+						return
+					}
+				}
+			}
+		}
+		if (zb0001Mask & 0x20) == 0 { // if not omitted
+			// write "ProtocolVersion"
+			err = en.Append(0xaf, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt32(z.ProtocolVersion)
+			if err != nil {
+				err = msgp.WrapError(err, "ProtocolVersion")
+				return
+			}
+		}
+		if (zb0001Mask & 0x40) == 0 { // if not omitted
+			// write "Capabilities"
+			err = en.Append(0xac, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteArrayHeader(uint32(len(z.Capabilities)))
+			if err != nil {
+				err = msgp.WrapError(err, "Capabilities")
+				return
+			}
+			for za0007 := range z.Capabilities {
+				err = en.WriteString(z.Capabilities[za0007])
+				if err != nil {
+					err = msgp.WrapError(err, "Capabilities", za0007)
+					return
+				}
+			}
+		}
+		if (zb0001Mask & 0x80) == 0 { // if not omitted
+			// write "Config"
+			err = en.Append(0xa6, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67)
+			if err != nil {
+				return
+			}
+			if z.Config == nil {
+				err = en.WriteNil()
+				if err != nil {
+					return
+				}
+			} else {
+				err = z.Config.EncodeMsg(en)
+				if err != nil {
+					err = msgp.WrapError(err, "Config")
+					return
+				}
+			}
+		}
+		if (zb0001Mask & 0x100) == 0 { // if not omitted
+			// write "Type"
+			err = en.Append(0xa4, 0x54, 0x79, 0x70, 0x65)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt(z.Type)
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		}
+		if (zb0001Mask & 0x200) == 0 { // if not omitted
+			// write "StatusCode"
+			err = en.Append(0xaa, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x6f, 0x64, 0x65)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt(z.StatusCode)
+			if err != nil {
+				err = msgp.WrapError(err, "StatusCode")
+				return
+			}
+		}
+		if (zb0001Mask & 0x400) == 0 { // if not omitted
+			// write "Header"
+			err = en.Append(0xa6, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72)
+			if err != nil {
+				return
+			}
+			err = en.WriteArrayHeader(uint32(len(z.Header)))
+			if err != nil {
+				err = msgp.WrapError(err, "Header")
+				return
+			}
+			for za0008 := range z.Header {
+				// array header, size 2
+				err = en.Append(0x92)
+				if err != nil {
+					return
+				}
+				err = en.WriteInt8(z.Header[za0008].Code)
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008, "Code")
+					return
+				}
+				err = en.WriteArrayHeader(uint32(len(z.Header[za0008].Args)))
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008, "Args")
+					return
+				}
+				for za0009 := range z.Header[za0008].Args {
+					err = en.WriteString(z.Header[za0008].Args[za0009])
+					if err != nil {
+						err = msgp.WrapError(err, "Header", za0008, "Args", za0009)
+						return
+					}
+				}
+			}
+		}
+		if (zb0001Mask & 0x800) == 0 { // if not omitted
+			// write "Body"
+			err = en.Append(0xa4, 0x42, 0x6f, 0x64, 0x79)
+			if err != nil {
+				return
+			}
+			err = en.WriteBytes(z.Body)
+			if err != nil {
+				err = msgp.WrapError(err, "Body")
+				return
+			}
+		}
+		if (zb0001Mask & 0x1000) == 0 { // if not omitted
+			// write "DelayMillis"
+			err = en.Append(0xab, 0x44, 0x65, 0x6c, 0x61, 0x79, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+			if err != nil {
+				return
+			}
+			err = en.WriteInt64(z.DelayMillis)
+			if err != nil {
+				err = msgp.WrapError(err, "DelayMillis")
+				return
+			}
+		}
 	}
 	return
 }
@@ -1393,13 +2440,49 @@ func (z *RPCMsgOut) EncodeMsg(en *msgp.Writer) (err error) {
 func (z *RPCMsgOut) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
 	// check for omitted fields
-	zb0001Len := uint32(4)
-	var zb0001Mask uint8 /* 4 bits */
+	zb0001Len := uint32(13)
+	var zb0001Mask uint16 /* 13 bits */
 	_ = zb0001Mask
 	if z.RespActions == nil {
 		zb0001Len--
 		zb0001Mask |= 0x8
 	}
+	if z.ReqActions == nil {
+		zb0001Len--
+		zb0001Mask |= 0x10
+	}
+	if z.ProtocolVersion == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x20
+	}
+	if z.Capabilities == nil {
+		zb0001Len--
+		zb0001Mask |= 0x40
+	}
+	if z.Config == nil {
+		zb0001Len--
+		zb0001Mask |= 0x80
+	}
+	if z.Type == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x100
+	}
+	if z.StatusCode == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x200
+	}
+	if z.Header == nil {
+		zb0001Len--
+		zb0001Mask |= 0x400
+	}
+	if z.Body == nil {
+		zb0001Len--
+		zb0001Mask |= 0x800
+	}
+	if z.DelayMillis == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x1000
+	}
 	// variable map header, size zb0001Len
 	o = append(o, 0x80|uint8(zb0001Len))
 
@@ -1434,6 +2517,80 @@ func (z *RPCMsgOut) MarshalMsg(b []byte) (o []byte, err error) {
 				}
 			}
 		}
+		if (zb0001Mask & 0x10) == 0 { // if not omitted
+			// string "ReqActions"
+			o = append(o, 0xaa, 0x52, 0x65, 0x71, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73)
+			o = msgp.AppendArrayHeader(o, uint32(len(z.ReqActions)))
+			for za0005 := range z.ReqActions {
+				// array header, size 2
+				o = append(o, 0x92)
+				o = msgp.AppendInt8(o, z.ReqActions[za0005].Code)
+				o = msgp.AppendArrayHeader(o, uint32(len(z.ReqActions[za0005].Args)))
+				for za0006 := range z.ReqActions[za0005].Args {
+					o = msgp.AppendString(o, z.ReqActions[za0005].Args[za0006])
+				}
+			}
+		}
+		if (zb0001Mask & 0x20) == 0 { // if not omitted
+			// string "ProtocolVersion"
+			o = append(o, 0xaf, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+			o = msgp.AppendInt32(o, z.ProtocolVersion)
+		}
+		if (zb0001Mask & 0x40) == 0 { // if not omitted
+			// string "Capabilities"
+			o = append(o, 0xac, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73)
+			o = msgp.AppendArrayHeader(o, uint32(len(z.Capabilities)))
+			for za0007 := range z.Capabilities {
+				o = msgp.AppendString(o, z.Capabilities[za0007])
+			}
+		}
+		if (zb0001Mask & 0x80) == 0 { // if not omitted
+			// string "Config"
+			o = append(o, 0xa6, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67)
+			if z.Config == nil {
+				o = msgp.AppendNil(o)
+			} else {
+				o, err = z.Config.MarshalMsg(o)
+				if err != nil {
+					err = msgp.WrapError(err, "Config")
+					return
+				}
+			}
+		}
+		if (zb0001Mask & 0x100) == 0 { // if not omitted
+			// string "Type"
+			o = append(o, 0xa4, 0x54, 0x79, 0x70, 0x65)
+			o = msgp.AppendInt(o, z.Type)
+		}
+		if (zb0001Mask & 0x200) == 0 { // if not omitted
+			// string "StatusCode"
+			o = append(o, 0xaa, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x43, 0x6f, 0x64, 0x65)
+			o = msgp.AppendInt(o, z.StatusCode)
+		}
+		if (zb0001Mask & 0x400) == 0 { // if not omitted
+			// string "Header"
+			o = append(o, 0xa6, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72)
+			o = msgp.AppendArrayHeader(o, uint32(len(z.Header)))
+			for za0008 := range z.Header {
+				// array header, size 2
+				o = append(o, 0x92)
+				o = msgp.AppendInt8(o, z.Header[za0008].Code)
+				o = msgp.AppendArrayHeader(o, uint32(len(z.Header[za0008].Args)))
+				for za0009 := range z.Header[za0008].Args {
+					o = msgp.AppendString(o, z.Header[za0008].Args[za0009])
+				}
+			}
+		}
+		if (zb0001Mask & 0x800) == 0 { // if not omitted
+			// string "Body"
+			o = append(o, 0xa4, 0x42, 0x6f, 0x64, 0x79)
+			o = msgp.AppendBytes(o, z.Body)
+		}
+		if (zb0001Mask & 0x1000) == 0 { // if not omitted
+			// string "DelayMillis"
+			o = append(o, 0xab, 0x44, 0x65, 0x6c, 0x61, 0x79, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73)
+			o = msgp.AppendInt64(o, z.DelayMillis)
+		}
 	}
 	return
 }
@@ -1546,6 +2703,166 @@ func (z *RPCMsgOut) UnmarshalMsg(bts []byte) (o []byte, err error) {
 					}
 				}
 			}
+		case "ReqActions":
+			var zb0007 uint32
+			zb0007, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ReqActions")
+				return
+			}
+			if cap(z.ReqActions) >= int(zb0007) {
+				z.ReqActions = (z.ReqActions)[:zb0007]
+			} else {
+				z.ReqActions = make([]Action, zb0007)
+			}
+			for za0005 := range z.ReqActions {
+				var zb0008 uint32
+				zb0008, bts, err = msgp.ReadArrayHeaderBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005)
+					return
+				}
+				if zb0008 != 2 {
+					err = msgp.ArrayError{Wanted: 2, Got: zb0008}
+					return
+				}
+				z.ReqActions[za0005].Code, bts, err = msgp.ReadInt8Bytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005, "Code")
+					return
+				}
+				var zb0009 uint32
+				zb0009, bts, err = msgp.ReadArrayHeaderBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ReqActions", za0005, "Args")
+					return
+				}
+				if cap(z.ReqActions[za0005].Args) >= int(zb0009) {
+					z.ReqActions[za0005].Args = (z.ReqActions[za0005].Args)[:zb0009]
+				} else {
+					z.ReqActions[za0005].Args = make([]string, zb0009)
+				}
+				for za0006 := range z.ReqActions[za0005].Args {
+					z.ReqActions[za0005].Args[za0006], bts, err = msgp.ReadStringBytes(bts)
+					if err != nil {
+						err = msgp.WrapError(err, "ReqActions", za0005, "Args", za0006)
+						return
+					}
+				}
+			}
+		case "ProtocolVersion":
+			z.ProtocolVersion, bts, err = msgp.ReadInt32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ProtocolVersion")
+				return
+			}
+		case "Capabilities":
+			var zb0010 uint32
+			zb0010, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Capabilities")
+				return
+			}
+			if cap(z.Capabilities) >= int(zb0010) {
+				z.Capabilities = (z.Capabilities)[:zb0010]
+			} else {
+				z.Capabilities = make([]string, zb0010)
+			}
+			for za0007 := range z.Capabilities {
+				z.Capabilities[za0007], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Capabilities", za0007)
+					return
+				}
+			}
+		case "Config":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Config = nil
+			} else {
+				if z.Config == nil {
+					z.Config = new(AgentConfig)
+				}
+				bts, err = z.Config.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Config")
+					return
+				}
+			}
+		case "Type":
+			z.Type, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "StatusCode":
+			z.StatusCode, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "StatusCode")
+				return
+			}
+		case "Header":
+			var zb0011 uint32
+			zb0011, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Header")
+				return
+			}
+			if cap(z.Header) >= int(zb0011) {
+				z.Header = (z.Header)[:zb0011]
+			} else {
+				z.Header = make([]Action, zb0011)
+			}
+			for za0008 := range z.Header {
+				var zb0012 uint32
+				zb0012, bts, err = msgp.ReadArrayHeaderBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008)
+					return
+				}
+				if zb0012 != 2 {
+					err = msgp.ArrayError{Wanted: 2, Got: zb0012}
+					return
+				}
+				z.Header[za0008].Code, bts, err = msgp.ReadInt8Bytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008, "Code")
+					return
+				}
+				var zb0013 uint32
+				zb0013, bts, err = msgp.ReadArrayHeaderBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Header", za0008, "Args")
+					return
+				}
+				if cap(z.Header[za0008].Args) >= int(zb0013) {
+					z.Header[za0008].Args = (z.Header[za0008].Args)[:zb0013]
+				} else {
+					z.Header[za0008].Args = make([]string, zb0013)
+				}
+				for za0009 := range z.Header[za0008].Args {
+					z.Header[za0008].Args[za0009], bts, err = msgp.ReadStringBytes(bts)
+					if err != nil {
+						err = msgp.WrapError(err, "Header", za0008, "Args", za0009)
+						return
+					}
+				}
+			}
+		case "Body":
+			z.Body, bts, err = msgp.ReadBytesBytes(bts, z.Body)
+			if err != nil {
+				err = msgp.WrapError(err, "Body")
+				return
+			}
+		case "DelayMillis":
+			z.DelayMillis, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "DelayMillis")
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -1574,5 +2891,30 @@ func (z *RPCMsgOut) Msgsize() (s int) {
 			s += msgp.StringPrefixSize + len(z.RespActions[za0003].Args[za0004])
 		}
 	}
+	s += 11 + msgp.ArrayHeaderSize
+	for za0005 := range z.ReqActions {
+		s += 1 + msgp.Int8Size + msgp.ArrayHeaderSize
+		for za0006 := range z.ReqActions[za0005].Args {
+			s += msgp.StringPrefixSize + len(z.ReqActions[za0005].Args[za0006])
+		}
+	}
+	s += 16 + msgp.Int32Size + 13 + msgp.ArrayHeaderSize
+	for za0007 := range z.Capabilities {
+		s += msgp.StringPrefixSize + len(z.Capabilities[za0007])
+	}
+	s += 7
+	if z.Config == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.Config.Msgsize()
+	}
+	s += 5 + msgp.IntSize + 11 + msgp.IntSize + 7 + msgp.ArrayHeaderSize
+	for za0008 := range z.Header {
+		s += 1 + msgp.Int8Size + msgp.ArrayHeaderSize
+		for za0009 := range z.Header[za0008].Args {
+			s += msgp.StringPrefixSize + len(z.Header[za0008].Args[za0009])
+		}
+	}
+	s += 5 + msgp.BytesPrefixSize + len(z.Body) + 12 + msgp.Int64Size
 	return
 }
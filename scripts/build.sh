@@ -8,7 +8,7 @@ export GOROOT
 export CGO_ENABLED=0
 
 go build .
-go test .
+go test . ./rpcserver ./sigscitest
 
 #### Run the linter
 #if [ -z "$(which gometalinter)" ]; then
@@ -32,8 +32,8 @@ rm -rf artifacts/
 mkdir -p artifacts/sigsci-module-golang
 cp --parents -rf \
   VERSION CHANGELOG.md LICENSE.md README.md \
-  clientcodec.go schema/rpc.go schema/rpc_gen.go rpcinspector.go inspector.go responsewriter.go module.go version.go config.go \
-  responsewriter_test.go module_test.go config_test.go \
+  clientcodec.go servercodec.go rpcserver/rpcserver.go sigscitest/sigscitest.go schema/rpc.go schema/rpc_gen.go schema/report.go rpcinspector.go rpcpool.go rpcmux.go rpcendpoint.go actions.go agentconfig.go breaker.go capabilities.go record.go health.go register.go reporter.go shutdown.go spool.go inspector.go msgpool.go responsewriter.go validate.go module.go version.go endrequest.go config.go \
+  servercodec_test.go rpcserver/rpcserver_test.go sigscitest/sigscitest_test.go responsewriter_test.go module_test.go config_test.go rpcinspector_test.go actions_test.go agentconfig_test.go breaker_test.go capabilities_test.go record_test.go health_test.go inspector_test.go msgpool_test.go reporter_test.go shutdown_test.go spool_test.go validate_test.go endrequest_test.go \
   examples \
   artifacts/sigsci-module-golang/
 
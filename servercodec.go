@@ -0,0 +1,144 @@
+package sigsci
+
+import (
+	"fmt"
+	"io"
+	"net/rpc"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// defines the server side of the MSGPACK RPC format
+type msgpServerCodec struct {
+	dec    *msgp.Reader
+	enc    *msgp.Writer
+	c      io.Closer
+	params *uint32 // number of params in the request being read
+}
+
+// NewMsgpServerCodec creates a new rpc.ServerCodec from an existing
+// connection, so that a rpc.Server can serve the calls made by a module
+// (e.g., to implement an agent compatible endpoint)
+func NewMsgpServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return msgpServerCodec{
+		dec:    msgp.NewReader(conn),
+		enc:    msgp.NewWriter(conn),
+		c:      conn,
+		params: new(uint32),
+	}
+}
+
+func (c msgpServerCodec) Close() error {
+	return c.c.Close()
+}
+
+func (c msgpServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	sz, err := c.dec.ReadArrayHeader()
+	if err != nil {
+		if cerr := knownError(err); cerr != nil {
+			return cerr
+		}
+		return fmt.Errorf("ReadRequestHeader failed in initial array: %s", err)
+	}
+	if sz != 4 {
+		return fmt.Errorf("ReadRequestHeader failed in initial array: invalid array size %d", sz)
+	}
+
+	msgtype, err := c.dec.ReadUint()
+	if err != nil {
+		return fmt.Errorf("ReadRequestHeader failed in message type: %s", err)
+	}
+	if msgtype != 0 {
+		return fmt.Errorf("ReadRequestHeader failed in message type: invalid message type %d", msgtype)
+	}
+
+	seqID, err := c.dec.ReadUint32()
+	if err != nil {
+		return fmt.Errorf("ReadRequestHeader failed in sequence id: %s", err)
+	}
+	r.Seq = uint64(seqID)
+
+	if r.ServiceMethod, err = c.dec.ReadString(); err != nil {
+		return fmt.Errorf("ReadRequestHeader failed in service method: %s", err)
+	}
+
+	if *c.params, err = c.dec.ReadArrayHeader(); err != nil {
+		return fmt.Errorf("ReadRequestHeader failed in params array header: %s", err)
+	}
+	return nil
+}
+
+func (c msgpServerCodec) ReadRequestBody(x interface{}) error {
+	n := *c.params
+	*c.params = 0
+	if n > 0 && x != nil {
+		n--
+		switch obj := x.(type) {
+		case msgp.Decodable:
+			if err := obj.DecodeMsg(c.dec); err != nil {
+				return fmt.Errorf("ReadRequestBody failed in obj decode: %s", err)
+			}
+		case *int:
+			val, err := c.dec.ReadInt()
+			if err != nil {
+				return fmt.Errorf("ReadRequestBody failed in int decode: %s", err)
+			}
+			*obj = val
+		default:
+			return fmt.Errorf("ReadRequestBody failed: unable to decode %T", x)
+		}
+	}
+
+	// the remaining params must still be consumed to keep the stream in sync
+	for ; n > 0; n-- {
+		if err := c.dec.Skip(); err != nil {
+			return fmt.Errorf("ReadRequestBody failed in skipping param: %s", err)
+		}
+	}
+	return nil
+}
+
+func (c msgpServerCodec) WriteResponse(r *rpc.Response, x interface{}) error {
+	if err := c.enc.WriteArrayHeader(4); err != nil {
+		return fmt.Errorf("WriteResponse failed in writing array header: %s", err)
+	}
+
+	if err := c.enc.WriteInt(1); err != nil {
+		return fmt.Errorf("WriteResponse failed in writing rpc msg type 1: %s", err)
+	}
+
+	if err := c.enc.WriteUint32(uint32(r.Seq)); err != nil {
+		return fmt.Errorf("WriteResponse failed in writing sequence id: %s", err)
+	}
+
+	if r.Error != "" {
+		if err := c.enc.WriteString(r.Error); err != nil {
+			return fmt.Errorf("WriteResponse failed in writing error: %s", err)
+		}
+		if err := c.enc.WriteNil(); err != nil {
+			return fmt.Errorf("WriteResponse failed in writing nil result: %s", err)
+		}
+	} else {
+		if err := c.enc.WriteNil(); err != nil {
+			return fmt.Errorf("WriteResponse failed in writing nil error: %s", err)
+		}
+		var err error
+		switch obj := x.(type) {
+		case msgp.Encodable:
+			err = obj.EncodeMsg(c.enc)
+		case *int:
+			err = c.enc.WriteInt(*obj)
+		default:
+			err = c.enc.WriteIntf(x)
+		}
+		if err != nil {
+			return fmt.Errorf("WriteResponse failed in writing %T: %s", x, err)
+		}
+	}
+
+	if err := c.enc.Flush(); err != nil {
+		return fmt.Errorf("WriteResponse failed in flushing: %s", err)
+	}
+
+	return nil
+}
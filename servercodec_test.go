@@ -0,0 +1,98 @@
+package sigsci
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// codecService is a service for testing the codecs
+type codecService struct{}
+
+func (codecService) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.RequestID = in.URI
+	return nil
+}
+
+func (codecService) PostRequest(in *RPCMsgIn, out *int) error {
+	*out = len(in.URI)
+	return nil
+}
+
+func (codecService) Fail(in *RPCMsgIn, out *int) error {
+	return errTestFailure
+}
+
+func TestMsgpServerCodec(t *testing.T) {
+	server := rpc.NewServer()
+	server.RegisterName("RPC", codecService{})
+	c1, c2 := net.Pipe()
+	go server.ServeCodec(NewMsgpServerCodec(c2))
+	client := rpc.NewClientWithCodec(NewMsgpClientCodec(c1))
+	defer client.Close()
+
+	out := RPCMsgOut{}
+	if err := client.Call("RPC.PreRequest", &RPCMsgIn{URI: "/path"}, &out); err != nil {
+		t.Fatalf("RPC.PreRequest failed: %s", err)
+	}
+	if out.WAFResponse != 200 || out.RequestID != "/path" {
+		t.Errorf("Unexpected output: %+v", out)
+	}
+	var n int
+	if err := client.Call("RPC.PostRequest", &RPCMsgIn{URI: "/path"}, &n); err != nil {
+		t.Fatalf("RPC.PostRequest failed: %s", err)
+	}
+	if n != 5 {
+		t.Errorf("Unexpected output: %d", n)
+	}
+
+	// Errors only fail the call
+	err := client.Call("RPC.Fail", &RPCMsgIn{}, &n)
+	if serr, ok := err.(rpc.ServerError); !ok || serr != rpc.ServerError("remote error: "+errTestFailure.Error()) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	err = client.Call("RPC.Unknown", &RPCMsgIn{}, &n)
+	if _, ok := err.(rpc.ServerError); !ok {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := client.Call("RPC.PostRequest", &RPCMsgIn{URI: "/"}, &n); err != nil || n != 1 {
+		t.Errorf("RPC.PostRequest failed after errors: %d %v", n, err)
+	}
+}
+
+func TestMsgpServerCodecExtraParams(t *testing.T) {
+	server := rpc.NewServer()
+	server.RegisterName("RPC", codecService{})
+	c1, c2 := net.Pipe()
+	go server.ServeCodec(NewMsgpServerCodec(c2))
+	defer c1.Close()
+
+	// A request with an extra param: [type, seq, method, [arg, extra]]
+	enc := msgp.NewWriter(c1)
+	go func() {
+		enc.WriteArrayHeader(4)
+		enc.WriteInt(0)
+		enc.WriteUint32(7)
+		enc.WriteString("RPC.PostRequest")
+		enc.WriteArrayHeader(2)
+		(&RPCMsgIn{URI: "/abc"}).EncodeMsg(enc)
+		enc.WriteString("extra")
+		enc.Flush()
+	}()
+
+	client := NewMsgpClientCodec(c1)
+	var resp rpc.Response
+	if err := client.ReadResponseHeader(&resp); err != nil {
+		t.Fatalf("Failed to read response header: %s", err)
+	}
+	var n int
+	if err := client.ReadResponseBody(&n); err != nil {
+		t.Fatalf("Failed to read response body: %s", err)
+	}
+	if resp.Seq != 7 || resp.Error != "" || n != 4 {
+		t.Errorf("Unexpected response seq=%d error=%q result=%d", resp.Seq, resp.Error, n)
+	}
+}
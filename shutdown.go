@@ -0,0 +1,103 @@
+package sigsci
+
+import (
+	"context"
+	"io"
+)
+
+// begin returns true if a new inspection can start, counting it as pending
+// until the caller calls m.pending.Done
+func (m *Module) begin() bool {
+	m.stopMu.RLock()
+	defer m.stopMu.RUnlock()
+	if m.stopped {
+		return false
+	}
+	m.pending.Add(1)
+	return true
+}
+
+// track counts background work as pending until the returned function is
+// called, which then calls fn (if any). It must only be called while an
+// inspection is pending.
+func (m *Module) track(fn func()) func() {
+	m.pending.Add(1)
+	return func() {
+		if fn != nil {
+			fn()
+		}
+		m.pending.Done()
+	}
+}
+
+// stop stops new inspections and background work (e.g., health checks)
+func (m *Module) stop() {
+	m.stopOnce.Do(func() {
+		m.stopMu.Lock()
+		m.stopped = true
+		m.stopMu.Unlock()
+		close(m.done)
+
+		// Send any partial batch now and any later reports immediately
+		if m.batcher != nil {
+			m.batcher.close()
+		}
+
+		// Stop the report workers once everything pending is complete
+		if m.reports != nil {
+			go func() {
+				m.pending.Wait()
+				m.reports.close()
+			}()
+		}
+	})
+}
+
+// Shutdown gracefully stops the module. New requests are passed through
+// to the handler without inspection, then Shutdown waits for the pending
+// inspections, background reports and InspectorFiniFunc calls to complete
+// before closing any connections to the agent. If the context expires
+// first, then the context error is returned and Close can be used to stop
+// the module without waiting.
+//
+// Shutdown is designed to be called after http.Server.Shutdown returns, so
+// that the reports for the final requests are sent to the agent.
+func (m *Module) Shutdown(ctx context.Context) error {
+	m.stop()
+
+	drained := make(chan struct{})
+	go func() {
+		m.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if m.spool != nil {
+		m.spool.close()
+	}
+	return m.closeInspector()
+}
+
+// Close immediately stops the module, without waiting for pending reports,
+// and closes any connections to the agent
+func (m *Module) Close() error {
+	m.stop()
+	return m.closeInspector()
+}
+
+// closeInspector closes the inspector created by the module if it holds
+// resources (e.g., the pooled connections of a RPCInspector)
+func (m *Module) closeInspector() error {
+	if m.config.Inspector() != nil {
+		// A custom inspector is closed by the application
+		return nil
+	}
+	if c, ok := m.inspector.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package sigsci
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestModuleShutdown(t *testing.T) {
+	insp := &blockingInspector{testInspector: testInspector{resp: 200}, release: make(chan struct{})}
+	var finis, inspected int32
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("X-Sigsci-Agentresponse") != "" {
+				atomic.AddInt32(&inspected, 1)
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}),
+		CustomInspector(insp, nil, func(_ *http.Request) { atomic.AddInt32(&finis, 1) }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	// The reports are still pending
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Unexpected Shutdown error: %v", err)
+	}
+
+	// New requests are not inspected once shutting down
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if n := atomic.LoadInt32(&inspected); n != 2 {
+		t.Errorf("Unexpected inspected requests=%d, expected=2", n)
+	}
+
+	close(insp.release)
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %s", err)
+	}
+	if n := atomic.LoadInt32(&insp.reports); n != 2 {
+		t.Errorf("Unexpected reports=%d, expected=2", n)
+	}
+	if n := atomic.LoadInt32(&finis); n != 2 {
+		t.Errorf("Unexpected finalizer calls=%d, expected=2", n)
+	}
+}
+
+func TestModuleShutdownReportQueue(t *testing.T) {
+	insp := &batchInspector{testInspector: testInspector{resp: 200}}
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}),
+		CustomInspector(insp, nil, nil),
+		ReportQueue(1, 10),
+		ReportBatch(10, time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// The partial batch is sent without waiting for the window
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %s", err)
+	}
+	if n := len(insp.Batches()); n != 1 {
+		t.Errorf("Unexpected batches=%d, expected=1", n)
+	}
+}
+
+func TestModuleShutdownClosesConnections(t *testing.T) {
+	agent := newTestAgent(t)
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		Socket("unix", agent.ln.Addr().String()),
+		ConnectionPool(1, 2),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %s", err)
+	}
+	pool := m.Inspector().(*RPCInspector).getBalancer().endpoints[0].pool
+	pool.mu.Lock()
+	closed, idle := pool.closed, len(pool.idle)
+	pool.mu.Unlock()
+	if !closed || idle != 0 {
+		t.Errorf("Unexpected pool state after shutdown: closed=%v idle=%d", closed, idle)
+	}
+
+	// Close after Shutdown is harmless
+	if err := m.Close(); err != nil {
+		t.Errorf("Close failed: %s", err)
+	}
+}
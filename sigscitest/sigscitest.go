@@ -0,0 +1,371 @@
+// Package sigscitest provides an in-memory inspector for unit testing
+// handlers wrapped by the module, without a running agent.
+//
+// The Inspector responds to PreRequest calls using programmable rules and
+// records every message sent by the module, so that tests can make
+// assertions on the data collected and wait for the reports sent in the
+// background after a request completes.
+package sigscitest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sigsci "github.com/signalsciences/sigsci-module-golang"
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// DefaultWaitTimeout is the timeout used by the assertions that wait for
+// background reports
+var DefaultWaitTimeout = 5 * time.Second
+
+// Rule matches a request sent in a PreRequest call and defines the
+// response. An empty match field matches any request.
+type Rule struct {
+	// Method matches the request method (e.g., "POST")
+	Method string
+	// Path matches the request path, without any query. A trailing "*"
+	// matches any path with the prefix before it.
+	Path string
+	// Headers match request headers by name (case insensitive) and value.
+	// An empty value matches any value, so only requires the header.
+	Headers [][2]string
+	// Body matches a request body containing the value
+	Body string
+	// Match is called to match the request if not nil, in addition to any
+	// other match fields
+	Match func(*schema.RPCMsgIn) bool
+
+	// WAFResponse is the response code (e.g., 200 to allow or 406 to
+	// block). The default is 200.
+	WAFResponse int32
+	// RequestID is returned so that the module sends an UpdateRequest
+	// call instead of a PostRequest call once the request completes
+	RequestID string
+	// RequestHeaders are added to the request (e.g., X-Sigsci-Tags)
+	RequestHeaders [][2]string
+	// RespActions edit the application response headers
+	RespActions []schema.Action
+	// ReqActions edit the request passed to the application (e.g.,
+	// schema.StripBody)
+	ReqActions []schema.Action
+
+	// Type, if set, has the module respond instead of the application
+	// (e.g., schema.EndRequest or schema.Tarpit), with the StatusCode,
+	// ResponseHeader and ResponseBody, after any Delay
+	Type int
+	// StatusCode is the status of the response for the Type
+	StatusCode int
+	// ResponseHeader edits the header of the response for the Type
+	ResponseHeader []schema.Action
+	// ResponseBody is the body of the response for the Type
+	ResponseBody string
+	// Delay is the delay before (or spread over, for schema.SlowResponse)
+	// the response for the Type
+	Delay time.Duration
+
+	// Err is returned instead of a response if not nil (e.g., to test
+	// that the module fails open)
+	Err error
+}
+
+// matches returns true if the rule matches the message
+func (r *Rule) matches(in *schema.RPCMsgIn) bool {
+	if r.Method != "" && !strings.EqualFold(r.Method, in.Method) {
+		return false
+	}
+	if r.Path != "" {
+		path := in.URI
+		if i := strings.IndexByte(path, '?'); i >= 0 {
+			path = path[:i]
+		}
+		if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+			if !strings.HasPrefix(path, prefix) {
+				return false
+			}
+		} else if path != r.Path {
+			return false
+		}
+	}
+	for _, want := range r.Headers {
+		if !hasHeader(in.HeadersIn, want[0], want[1]) {
+			return false
+		}
+	}
+	if r.Body != "" && !strings.Contains(in.PostBody, r.Body) {
+		return false
+	}
+	if r.Match != nil && !r.Match(in) {
+		return false
+	}
+	return true
+}
+
+// respond sets the output from the rule
+func (r *Rule) respond(out *schema.RPCMsgOut) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	out.WAFResponse = r.WAFResponse
+	if out.WAFResponse == 0 {
+		out.WAFResponse = http.StatusOK
+	}
+	out.RequestID = r.RequestID
+	out.RequestHeaders = r.RequestHeaders
+	out.RespActions = r.RespActions
+	out.ReqActions = r.ReqActions
+	if r.Type != 0 {
+		out.Type = r.Type
+		out.StatusCode = r.StatusCode
+		out.Header = r.ResponseHeader
+		out.Body = []byte(r.ResponseBody)
+		out.DelayMillis = r.Delay.Milliseconds()
+	}
+	return nil
+}
+
+// hasHeader returns true if the headers include the name with the value,
+// or with any value if the value is empty
+func hasHeader(headers [][2]string, name, value string) bool {
+	for _, kv := range headers {
+		if strings.EqualFold(kv[0], name) && (value == "" || kv[1] == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspector is a sigsci.Inspector that responds to PreRequest calls using
+// the first matching rule (allowing the request if no rule matches) and
+// records all the messages sent by the module. It is safe for concurrent
+// use.
+type Inspector struct {
+	mu      sync.Mutex
+	rules   []Rule
+	changed chan struct{} // closed and replaced when a message is recorded
+
+	moduleInits    []schema.RPCMsgIn
+	preRequests    []schema.RPCMsgIn
+	postRequests   []schema.RPCMsgIn
+	updateRequests []schema.RPCMsgIn2
+}
+
+var _ sigsci.Inspector = (*Inspector)(nil)
+
+// NewInspector returns an inspector with the rules
+func NewInspector(rules ...Rule) *Inspector {
+	return &Inspector{
+		rules:   rules,
+		changed: make(chan struct{}),
+	}
+}
+
+// AddRule adds a rule, which is matched after any existing rules
+func (i *Inspector) AddRule(r Rule) {
+	i.mu.Lock()
+	i.rules = append(i.rules, r)
+	i.mu.Unlock()
+}
+
+// Reset removes all the rules and recorded messages
+func (i *Inspector) Reset() {
+	i.mu.Lock()
+	i.rules = nil
+	i.moduleInits = nil
+	i.preRequests = nil
+	i.postRequests = nil
+	i.updateRequests = nil
+	i.mu.Unlock()
+}
+
+// ModuleInit records the message and responds with a 200, enabling all the
+// capabilities offered by the module so that rules can use every response
+// type and action
+func (i *Inspector) ModuleInit(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	i.record(func() { i.moduleInits = append(i.moduleInits, *in) })
+	out.WAFResponse = http.StatusOK
+	out.ProtocolVersion = schema.ProtocolVersion
+	out.Capabilities = in.Capabilities
+	return nil
+}
+
+// PreRequest records the message and responds using the first matching rule
+func (i *Inspector) PreRequest(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	var rule *Rule
+	i.record(func() {
+		i.preRequests = append(i.preRequests, *in)
+		for n := range i.rules {
+			if i.rules[n].matches(in) {
+				r := i.rules[n]
+				rule = &r
+				break
+			}
+		}
+	})
+	if rule == nil {
+		rule = &Rule{}
+	}
+	return rule.respond(out)
+}
+
+// PostRequest records the message
+func (i *Inspector) PostRequest(in *schema.RPCMsgIn, out *schema.RPCMsgOut) error {
+	i.record(func() { i.postRequests = append(i.postRequests, *in) })
+	return nil
+}
+
+// UpdateRequest records the message
+func (i *Inspector) UpdateRequest(in *schema.RPCMsgIn2, out *schema.RPCMsgOut) error {
+	i.record(func() { i.updateRequests = append(i.updateRequests, *in) })
+	return nil
+}
+
+// record calls fn with the lock held, then wakes up any waiters
+func (i *Inspector) record(fn func()) {
+	i.mu.Lock()
+	fn()
+	close(i.changed)
+	i.changed = make(chan struct{})
+	i.mu.Unlock()
+}
+
+// ModuleInits returns the recorded ModuleInit messages
+func (i *Inspector) ModuleInits() []schema.RPCMsgIn {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]schema.RPCMsgIn(nil), i.moduleInits...)
+}
+
+// PreRequests returns the recorded PreRequest messages
+func (i *Inspector) PreRequests() []schema.RPCMsgIn {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]schema.RPCMsgIn(nil), i.preRequests...)
+}
+
+// PostRequests returns the recorded PostRequest messages
+func (i *Inspector) PostRequests() []schema.RPCMsgIn {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]schema.RPCMsgIn(nil), i.postRequests...)
+}
+
+// UpdateRequests returns the recorded UpdateRequest messages
+func (i *Inspector) UpdateRequests() []schema.RPCMsgIn2 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]schema.RPCMsgIn2(nil), i.updateRequests...)
+}
+
+// wait waits until cond returns true, which is called with the lock held
+// each time a message is recorded, returning false on timeout
+func (i *Inspector) wait(timeout time.Duration, cond func() bool) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		i.mu.Lock()
+		ok, changed := cond(), i.changed
+		i.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// WaitPostRequests waits until at least n PostRequest messages have been
+// recorded, returning the messages or an error on timeout
+func (i *Inspector) WaitPostRequests(n int, timeout time.Duration) ([]schema.RPCMsgIn, error) {
+	if !i.wait(timeout, func() bool { return len(i.postRequests) >= n }) {
+		return i.PostRequests(), fmt.Errorf("timed out after %s waiting for %d PostRequest messages", timeout, n)
+	}
+	return i.PostRequests(), nil
+}
+
+// WaitUpdateRequests waits until at least n UpdateRequest messages have
+// been recorded, returning the messages or an error on timeout
+func (i *Inspector) WaitUpdateRequests(n int, timeout time.Duration) ([]schema.RPCMsgIn2, error) {
+	if !i.wait(timeout, func() bool { return len(i.updateRequests) >= n }) {
+		return i.UpdateRequests(), fmt.Errorf("timed out after %s waiting for %d UpdateRequest messages", timeout, n)
+	}
+	return i.UpdateRequests(), nil
+}
+
+// AssertPreRequest fails the test if no PreRequest message was recorded
+// for the method and path (without any query), returning the last message
+// recorded for them
+func (i *Inspector) AssertPreRequest(t testing.TB, method, path string) *schema.RPCMsgIn {
+	t.Helper()
+	r := Rule{Method: method, Path: path}
+	msgs := i.PreRequests()
+	for n := len(msgs) - 1; n >= 0; n-- {
+		if r.matches(&msgs[n]) {
+			return &msgs[n]
+		}
+	}
+	t.Fatalf("No PreRequest message for %s %s in %d messages", method, path, len(msgs))
+	return nil
+}
+
+// AssertPostRequest waits up to DefaultWaitTimeout for a PostRequest
+// message for the method and path (without any query), failing the test
+// if there is none, and returns the first message recorded for them
+func (i *Inspector) AssertPostRequest(t testing.TB, method, path string) *schema.RPCMsgIn {
+	t.Helper()
+	r := Rule{Method: method, Path: path}
+	var msg *schema.RPCMsgIn
+	found := i.wait(DefaultWaitTimeout, func() bool {
+		for n := range i.postRequests {
+			if r.matches(&i.postRequests[n]) {
+				m := i.postRequests[n]
+				msg = &m
+				return true
+			}
+		}
+		return false
+	})
+	if !found {
+		t.Fatalf("No PostRequest message for %s %s after %s", method, path, DefaultWaitTimeout)
+	}
+	return msg
+}
+
+// AssertUpdateRequest waits up to DefaultWaitTimeout for an UpdateRequest
+// message with the request ID, failing the test if there is none, and
+// returns the first message recorded for it
+func (i *Inspector) AssertUpdateRequest(t testing.TB, requestID string) *schema.RPCMsgIn2 {
+	t.Helper()
+	var msg *schema.RPCMsgIn2
+	found := i.wait(DefaultWaitTimeout, func() bool {
+		for n := range i.updateRequests {
+			if i.updateRequests[n].RequestID == requestID {
+				m := i.updateRequests[n]
+				msg = &m
+				return true
+			}
+		}
+		return false
+	})
+	if !found {
+		t.Fatalf("No UpdateRequest message for RequestID=%s after %s", requestID, DefaultWaitTimeout)
+	}
+	return msg
+}
+
+// AssertNoReports fails the test if any PostRequest or UpdateRequest
+// message has been recorded. As reports are sent in the background, this
+// should be called once the module has been shut down.
+func (i *Inspector) AssertNoReports(t testing.TB) {
+	t.Helper()
+	if posts, updates := i.PostRequests(), i.UpdateRequests(); len(posts) > 0 || len(updates) > 0 {
+		t.Errorf("Unexpected reports: %d PostRequest and %d UpdateRequest messages", len(posts), len(updates))
+	}
+}
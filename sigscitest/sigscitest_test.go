@@ -0,0 +1,135 @@
+package sigscitest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sigsci "github.com/signalsciences/sigsci-module-golang"
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// newModule wraps a handler echoing the X-Sigsci-Tags request header
+func newModule(t *testing.T, insp *Inspector) *sigsci.Module {
+	m, err := sigsci.NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			io.WriteString(w, req.Header.Get("X-Sigsci-Tags"))
+		}),
+		sigsci.CustomInspector(insp, nil, nil),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestInspector(t *testing.T) {
+	insp := NewInspector(
+		Rule{Method: "POST", Path: "/login", Body: "<script>", WAFResponse: 406},
+		Rule{Path: "/api/*", Headers: [][2]string{{"x-debug", ""}}, RequestID: "0123456789abcdef01234567", RequestHeaders: [][2]string{{"X-Sigsci-Tags", "DEBUG"}}},
+	)
+	m := newModule(t, insp)
+	if inits := insp.ModuleInits(); len(inits) != 1 || inits[0].ModuleVersion != m.Version() {
+		t.Errorf("Unexpected ModuleInit messages: %+v", inits)
+	}
+
+	cases := []struct {
+		method, uri, body string
+		header            string
+		status            int
+		resp              string
+	}{
+		{"GET", "/", "", "", 200, ""},
+		{"POST", "/login", "<script>", "", 406, "406 Not Acceptable\n\n"},
+		{"POST", "/login", "user=a", "", 200, ""},
+		{"GET", "/api/v1?q=1", "", "X-Debug", 200, "DEBUG"},
+		{"GET", "/api/v1", "", "", 200, ""},
+	}
+	for pos, tt := range cases {
+		req := httptest.NewRequest(tt.method, tt.uri, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.header != "" {
+			req.Header.Set(tt.header, "1")
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		if w.Code != tt.status || w.Body.String() != tt.resp {
+			t.Errorf("test %d: unexpected response %d %q, expected %d %q", pos, w.Code, w.Body.String(), tt.status, tt.resp)
+		}
+	}
+
+	if in := insp.AssertPreRequest(t, "POST", "/login"); in.PostBody != "user=a" {
+		t.Errorf("Unexpected PreRequest message: %+v", in)
+	}
+	if in := insp.AssertPostRequest(t, "POST", "/login"); in.ResponseCode != 406 {
+		t.Errorf("Unexpected PostRequest message: %+v", in)
+	}
+	if in2 := insp.AssertUpdateRequest(t, "0123456789abcdef01234567"); in2.ResponseCode != 200 {
+		t.Errorf("Unexpected UpdateRequest message: %+v", in2)
+	}
+	if updates, err := insp.WaitUpdateRequests(2, 0); err == nil {
+		t.Errorf("Expected a timeout, got %+v", updates)
+	}
+}
+
+func TestInspectorResponseTypes(t *testing.T) {
+	insp := NewInspector(
+		Rule{Path: "/tarpit", Type: schema.Tarpit, StatusCode: 429, ResponseBody: "slow down", Delay: 10 * time.Millisecond},
+		Rule{Path: "/maintenance", Type: schema.EndRequest, StatusCode: 503, ResponseHeader: []schema.Action{{Code: schema.SetHdr, Args: []string{"Retry-After", "60"}}}},
+		Rule{Path: "/sanitize", ReqActions: []schema.Action{{Code: schema.SetHdr, Args: []string{"X-Sigsci-Tags", "SANITIZED"}}}},
+	)
+	m := newModule(t, insp)
+	if caps := strings.Join(m.AgentCapabilities(), ","); !strings.Contains(caps, schema.CapTarpit) || !strings.Contains(caps, schema.CapReqActions) {
+		t.Errorf("Unexpected agent capabilities %q", caps)
+	}
+
+	cases := []struct {
+		uri    string
+		status int
+		resp   string
+	}{
+		{"/tarpit", 429, "slow down"},
+		{"/maintenance", 503, ""},
+		{"/sanitize", 200, "SANITIZED"},
+	}
+	for pos, tt := range cases {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", tt.uri, nil))
+		if w.Code != tt.status || w.Body.String() != tt.resp {
+			t.Errorf("test %d: unexpected response %d %q, expected %d %q", pos, w.Code, w.Body.String(), tt.status, tt.resp)
+		}
+		if tt.status == 503 && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("test %d: unexpected response header %v", pos, w.Header())
+		}
+	}
+}
+
+func TestInspectorError(t *testing.T) {
+	insp := NewInspector()
+	m := newModule(t, insp)
+	insp.AddRule(Rule{Err: errors.New("agent down")})
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 {
+		t.Errorf("Expected to fail open, got %d", w.Code)
+	}
+	if len(insp.PreRequests()) != 1 {
+		t.Errorf("Expected a PreRequest message")
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Failed to close module: %s", err)
+	}
+	insp.AssertNoReports(t)
+
+	insp.Reset()
+	out := schema.RPCMsgOut{}
+	if err := insp.PreRequest(&schema.RPCMsgIn{URI: "/"}, &out); err != nil || out.WAFResponse != 200 {
+		t.Errorf("Unexpected PreRequest result after reset: %d %v", out.WAFResponse, err)
+	}
+}
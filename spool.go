@@ -0,0 +1,288 @@
+package sigsci
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	// spoolPrefix and spoolSuffix name the spool files, with a sequence
+	// number between them so that the files sort oldest first
+	spoolPrefix = "sigsci-spool-"
+	spoolSuffix = ".msgp"
+	// spoolBadSuffix is added to the name of a spool file that could not be
+	// read, keeping it aside without replaying it again
+	spoolBadSuffix = ".bad"
+	// spoolSegments is the number of files the spool size is split over,
+	// so that the oldest file can be removed when the spool is full
+	spoolSegments = 4
+)
+
+// spool record kinds, written before each message
+const (
+	spoolPostRequest   = 1
+	spoolUpdateRequest = 2
+)
+
+// reportSpool stores reports that could not be sent to the agent on disk
+// so that they can be sent once the agent is reachable again. Each record
+// is the kind of report followed by the msgpack encoded message.
+type reportSpool struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	seq   uint64
+	files []spoolFile // oldest first, the last is being written if f is set
+	total int64
+	f     *os.File
+}
+
+type spoolFile struct {
+	name string
+	size int64
+}
+
+// openSpool opens a spool in dir, picking up any files from a previous run
+func openSpool(dir string, maxBytes int64) (*reportSpool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %s", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %s", err)
+	}
+	s := &reportSpool{dir: dir, maxBytes: maxBytes}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, spoolPrefix) || !strings.HasSuffix(name, spoolSuffix) {
+			continue
+		}
+		var seq uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, spoolPrefix), spoolSuffix), "%d", &seq); err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+		s.files = append(s.files, spoolFile{name: name, size: info.Size()})
+		s.total += info.Size()
+	}
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+	return s, nil
+}
+
+// append writes a report to the spool, removing the oldest spooled
+// reports if the spool is full
+func (s *reportSpool) append(kind int, msg msgp.Encodable) error {
+	var buf bytes.Buffer
+	w := msgp.NewWriter(&buf)
+	if err := w.WriteInt(kind); err != nil {
+		return err
+	}
+	if err := msg.EncodeMsg(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	rec := buf.Bytes()
+	size := int64(len(rec))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Rotate to a new file once the current file is a full segment
+	if s.f != nil && s.files[len(s.files)-1].size+size > s.maxBytes/spoolSegments {
+		s.rotateLocked()
+	}
+
+	// Make room by removing the oldest files that are not being written
+	for s.total+size > s.maxBytes && len(s.files) > 0 && (s.f == nil || len(s.files) > 1) {
+		oldest := s.files[0]
+		os.Remove(filepath.Join(s.dir, oldest.name))
+		s.files = s.files[1:]
+		s.total -= oldest.size
+	}
+	if s.total+size > s.maxBytes {
+		return errors.New("spool is full")
+	}
+
+	if s.f == nil {
+		name := fmt.Sprintf("%s%020d%s", spoolPrefix, s.seq, spoolSuffix)
+		f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		s.seq++
+		s.f = f
+		s.files = append(s.files, spoolFile{name: name})
+	}
+	if _, err := s.f.Write(rec); err != nil {
+		return err
+	}
+	s.files[len(s.files)-1].size += size
+	s.total += size
+	return nil
+}
+
+// rotateLocked closes the file being written, so that the next report is
+// written to a new file
+func (s *reportSpool) rotateLocked() {
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+}
+
+// take removes the complete spool files from the spool, returning their
+// paths oldest first. The caller is responsible for removing the files.
+func (s *reportSpool) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotateLocked()
+	paths := make([]string, len(s.files))
+	for i, f := range s.files {
+		paths[i] = filepath.Join(s.dir, f.name)
+	}
+	s.files = nil
+	s.total = 0
+	return paths
+}
+
+// empty returns true if there is nothing spooled
+func (s *reportSpool) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files) == 0
+}
+
+// close closes the file being written. Any later report is written to a
+// new file.
+func (s *reportSpool) close() {
+	s.mu.Lock()
+	s.rotateLocked()
+	s.mu.Unlock()
+}
+
+// readSpoolFile calls fn for each report in the spool file. A partially
+// written record (e.g., after a crash) ends the file.
+func readSpoolFile(path string, fn func(kind int, msg msgp.Encodable)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := msgp.NewReader(f)
+	for {
+		kind, err := r.ReadInt()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch kind {
+		case spoolPostRequest:
+			var in RPCMsgIn
+			if err := in.DecodeMsg(r); err != nil {
+				return err
+			}
+			fn(kind, &in)
+		case spoolUpdateRequest:
+			var in RPCMsgIn2
+			if err := in.DecodeMsg(r); err != nil {
+				return err
+			}
+			fn(kind, &in)
+		default:
+			return fmt.Errorf("unknown spool record kind %d", kind)
+		}
+	}
+}
+
+// spoolReport writes a report that failed to send to the spool, if any.
+// Reports rejected by the agent itself are not spooled as they would only
+// be rejected again.
+func (m *Module) spoolReport(kind int, msg msgp.Encodable, err error) {
+	var serr rpc.ServerError
+	if m.spool == nil || errors.As(err, &serr) || isContextError(err) {
+		return
+	}
+	if err := m.spool.append(kind, msg); err != nil && m.config.Debug() {
+		log.Printf("ERROR: failed to spool report: %s", err)
+	}
+}
+
+// replaySpool sends the spooled reports to the agent, stopping (and
+// spooling the remaining reports again) if the agent is unavailable. Only
+// one replay is run at a time.
+func (m *Module) replaySpool() {
+	if m.spool == nil || m.spool.empty() || !atomic.CompareAndSwapInt32(&m.replaying, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&m.replaying, 0)
+
+	var sent, failed int
+	for _, path := range m.spool.take() {
+		err := readSpoolFile(path, func(kind int, msg msgp.Encodable) {
+			var err error
+			if failed == 0 {
+				select {
+				case <-m.done:
+					err = errors.New("module stopped")
+				default:
+					err = m.sendSpooled(kind, msg)
+				}
+			}
+			if err == nil && failed == 0 {
+				sent++
+				return
+			}
+			// Keep the report for the next replay
+			failed++
+			if err := m.spool.append(kind, msg); err != nil && m.config.Debug() {
+				log.Printf("ERROR: failed to spool report: %s", err)
+			}
+		})
+		if err != nil {
+			// Keep the reports that were not read for inspection
+			if m.config.Debug() {
+				log.Printf("ERROR: failed to read spool file %s, keeping it as %s: %s", path, path+spoolBadSuffix, err)
+			}
+			os.Rename(path, path+spoolBadSuffix)
+			continue
+		}
+		os.Remove(path)
+	}
+	if m.config.Debug() {
+		log.Printf("DEBUG: replayed %d spooled reports (%d kept for later)", sent, failed)
+	}
+}
+
+// sendSpooled sends a spooled report to the inspector
+func (m *Module) sendSpooled(kind int, msg msgp.Encodable) error {
+	switch in := msg.(type) {
+	case *RPCMsgIn:
+		return m.callInspector(func() error { return m.inspector.PostRequest(in, &RPCMsgOut{}) })
+	case *RPCMsgIn2:
+		return m.callInspector(func() error { return m.inspector.UpdateRequest(in, &RPCMsgOut{}) })
+	}
+	return fmt.Errorf("unknown spool record kind %d", kind)
+}
@@ -0,0 +1,270 @@
+package sigsci
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+func TestReportSpool(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %s", err)
+	}
+	post := &RPCMsgIn{Method: "GET", URI: "/missing", ResponseCode: 404, HeadersOut: [][2]string{{"Content-Type", "text/plain"}}}
+	update := &RPCMsgIn2{RequestID: "0123456789abcdef01234567", ResponseCode: 500}
+	if err := s.append(spoolPostRequest, post); err != nil {
+		t.Fatalf("Failed to spool: %s", err)
+	}
+	if err := s.append(spoolUpdateRequest, update); err != nil {
+		t.Fatalf("Failed to spool: %s", err)
+	}
+	s.close()
+
+	// The spool is picked up by a later run
+	s, err = openSpool(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to reopen spool: %s", err)
+	}
+	if s.empty() {
+		t.Fatal("Expected the reopened spool to have reports")
+	}
+	if err := s.append(spoolPostRequest, post); err != nil {
+		t.Fatalf("Failed to spool: %s", err)
+	}
+	paths := s.take()
+	if len(paths) != 2 || !s.empty() {
+		t.Fatalf("Unexpected spool files: %v", paths)
+	}
+
+	var got []msgp.Encodable
+	for _, path := range paths {
+		if err := readSpoolFile(path, func(kind int, msg msgp.Encodable) { got = append(got, msg) }); err != nil {
+			t.Fatalf("Failed to read spool file: %s", err)
+		}
+	}
+	expected := []msgp.Encodable{post, update, post}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected spooled reports:\n%#v\nexpected:\n%#v", got, expected)
+	}
+}
+
+func TestReportSpoolMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	post := &RPCMsgIn{URI: "/0123456789"}
+	size := int64(post.Msgsize())
+	s, err := openSpool(dir, 8*size)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %s", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := s.append(spoolPostRequest, post); err != nil {
+			t.Fatalf("Failed to spool: %s", err)
+		}
+	}
+	if s.total > s.maxBytes {
+		t.Errorf("Spool size %d exceeds the maximum %d", s.total, s.maxBytes)
+	}
+	var total int64
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		info, _ := e.Info()
+		total += info.Size()
+	}
+	if total != s.total || len(entries) != len(s.files) {
+		t.Errorf("Unexpected spool files: %d files with %d bytes, expected %d files with %d bytes", len(entries), total, len(s.files), s.total)
+	}
+
+	// The oldest reports were removed, so the newest are kept
+	if s.files[len(s.files)-1].name <= "sigsci-spool-00000000000000000001" {
+		t.Errorf("Unexpected newest spool file %s", s.files[len(s.files)-1].name)
+	}
+}
+
+// spoolInspector is a test inspector where reports can be made to fail
+type spoolInspector struct {
+	testInspector
+	fail     int32
+	failures int32
+
+	mu   sync.Mutex
+	uris []string // successfully reported
+}
+
+func (insp *spoolInspector) ModuleInit(in *RPCMsgIn, out *RPCMsgOut) error {
+	if atomic.LoadInt32(&insp.fail) != 0 {
+		return errTestFailure
+	}
+	return insp.testInspector.ModuleInit(in, out)
+}
+
+func (insp *spoolInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	if atomic.LoadInt32(&insp.fail) != 0 {
+		atomic.AddInt32(&insp.failures, 1)
+		return errTestFailure
+	}
+	insp.mu.Lock()
+	insp.uris = append(insp.uris, in.URI)
+	insp.mu.Unlock()
+	return nil
+}
+
+func (insp *spoolInspector) URIs() []string {
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	return append([]string(nil), insp.uris...)
+}
+
+func TestModuleSpool(t *testing.T) {
+	dir := t.TempDir()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	// Reports fail while the agent is unavailable
+	insp := &spoolInspector{testInspector: testInspector{resp: 200}, fail: 1}
+	m, err := NewModule(handler,
+		CustomInspector(insp, nil, nil),
+		Spool(dir, 1<<20),
+		RegisterBackoff(5*time.Millisecond, 5*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	for _, uri := range []string{"/a", "/b"} {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", uri, nil))
+		m.pending.Wait() // the report has been spooled
+	}
+	if n := atomic.LoadInt32(&insp.failures); n != 2 {
+		t.Fatalf("Unexpected failed reports=%d, expected=2", n)
+	}
+
+	// The spooled reports are sent once the agent is available
+	atomic.StoreInt32(&insp.fail, 0)
+	waitFor(t, func() bool { return len(insp.URIs()) == 2 })
+	if uris := insp.URIs(); uris[0] != "/a" || uris[1] != "/b" {
+		t.Errorf("Unexpected replayed reports %v", uris)
+	}
+	waitFor(t, func() bool { return m.spool.empty() })
+
+	// Reports spooled by a previous run are sent on startup
+	atomic.StoreInt32(&insp.fail, 1)
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/c", nil))
+	m.pending.Wait()
+	m.Close()
+
+	insp2 := &spoolInspector{testInspector: testInspector{resp: 200}}
+	m2, err := NewModule(handler, CustomInspector(insp2, nil, nil), Spool(dir, 1<<20))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m2.Close()
+	waitFor(t, func() bool { return len(insp2.URIs()) == 1 })
+	if uris := insp2.URIs(); uris[0] != "/c" {
+		t.Errorf("Unexpected replayed reports %v", uris)
+	}
+}
+
+func TestModuleSpoolUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %s", err)
+	}
+	if err := s.append(spoolPostRequest, &RPCMsgIn{Method: "GET", URI: "/a"}); err != nil {
+		t.Fatalf("Failed to spool: %s", err)
+	}
+	paths := s.take()
+	if len(paths) != 1 {
+		t.Fatalf("Unexpected spool files: %v", paths)
+	}
+	// A record that cannot be read ends the replay of the file
+	f, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("Failed to open spool file: %s", err)
+	}
+	if _, err := f.Write(msgp.AppendInt(nil, 99)); err != nil {
+		t.Fatalf("Failed to write spool file: %s", err)
+	}
+	f.Close()
+
+	insp := &spoolInspector{testInspector: testInspector{resp: 200}}
+	m, err := NewModule(http.NotFoundHandler(), CustomInspector(insp, nil, nil), Spool(dir, 1<<20))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+	waitFor(t, func() bool { return len(insp.URIs()) == 1 })
+
+	// The file is kept aside rather than removed, and not replayed again
+	waitFor(t, func() bool {
+		_, err := os.Stat(paths[0] + spoolBadSuffix)
+		return err == nil
+	})
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the unreadable spool file to be renamed, got %v", err)
+	}
+	if !m.spool.empty() {
+		t.Error("Expected the unreadable spool file not to be spooled")
+	}
+}
+
+func TestModuleSpoolHealthCheck(t *testing.T) {
+	insp := &spoolInspector{testInspector: testInspector{resp: 200}}
+	m, err := NewModule(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}),
+		CustomInspector(insp, nil, nil),
+		Spool(t.TempDir(), 1<<20),
+		HealthCheck(5*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	atomic.StoreInt32(&insp.fail, 1)
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	m.pending.Wait()
+	if m.spool.empty() {
+		t.Fatal("Expected the failed report to be spooled")
+	}
+	// Let the replay on startup and the health check see the agent down
+	time.Sleep(20 * time.Millisecond)
+
+	// Without further traffic, the health check probe seeing the agent
+	// recover sends the spooled reports
+	atomic.StoreInt32(&insp.fail, 0)
+	waitFor(t, func() bool { return len(insp.URIs()) == 1 })
+	if uris := insp.URIs(); uris[0] != "/a" {
+		t.Errorf("Unexpected replayed reports %v", uris)
+	}
+}
+
+func TestModuleSpoolRejected(t *testing.T) {
+	m := &Module{config: &ModuleConfig{}}
+	var err error
+	if m.spool, err = openSpool(t.TempDir(), 1<<20); err != nil {
+		t.Fatalf("Failed to open spool: %s", err)
+	}
+
+	// Reports rejected by the agent are not kept
+	m.spoolReport(spoolPostRequest, &RPCMsgIn{}, rpc.ServerError("remote error: invalid"))
+	if !m.spool.empty() {
+		t.Error("Expected a rejected report not to be spooled")
+	}
+	m.spoolReport(spoolPostRequest, &RPCMsgIn{}, errTestFailure)
+	if m.spool.empty() {
+		t.Error("Expected a failed report to be spooled")
+	}
+}
@@ -0,0 +1,219 @@
+package sigsci
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+// maxEndRequestBody limits the body of an EndRequest response
+const maxEndRequestBody = 1 << 20
+
+// ProtocolError is an inspector response that violates the protocol (e.g.,
+// an invalid header name). The invalid parts of the response are not
+// applied, and in strict mode none of it is.
+type ProtocolError struct {
+	Method string // RPC method (e.g., "RPC.PreRequest")
+	Err    error
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("invalid %s response: %s", e.Method, e.Err)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// checkOut validates the response to an inspector call, removing the
+// invalid parts so that the rest of the response (e.g., the decision to
+// block) still applies, and logging and returning any violation as a
+// ProtocolError
+func (m *Module) checkOut(method string, out *RPCMsgOut) error {
+	var err error
+	if method == "RPC.PreRequest" {
+		err = m.validatePreRequestOut(out)
+	} else {
+		err = validateReportOut(out)
+	}
+	if err == nil {
+		return nil
+	}
+	perr := &ProtocolError{Method: method, Err: err}
+	log.Printf("ERROR: %s", perr)
+	return perr
+}
+
+// validatePreRequestOut returns an error if a PreRequest response would
+// apply invalid values to the request or response, removing them. An
+// invalid response type (e.g., an EndRequest status) is removed as a
+// whole, and otherwise only the invalid entries (e.g., a header action)
+// are. The WAFResponse is not checked, as it is not used by the response
+// types (e.g., EndRequest) and an invalid code otherwise fails open in
+// ServeHTTP, with the request still reported.
+func (m *Module) validatePreRequestOut(out *RPCMsgOut) error {
+	var errs []error
+	errs = append(errs, validateReportOut(out))
+	var err error
+	out.ReqActions, err = removeInvalid("request action", out.ReqActions, validateRequestAction)
+	errs = append(errs, err)
+
+	switch out.Type {
+	case 0:
+	case schema.EndRequest, schema.Tarpit, schema.DropConnection, schema.SlowResponse:
+		if out.StatusCode < 200 || out.StatusCode > 599 {
+			errs = append(errs, fmt.Errorf("invalid EndRequest status %d", out.StatusCode))
+			dropResponseType(out)
+			break
+		}
+		out.Header, err = removeInvalid("EndRequest header action", out.Header, validateHeaderAction)
+		errs = append(errs, err)
+		if len(out.Body) > maxEndRequestBody {
+			errs = append(errs, fmt.Errorf("EndRequest body of %d bytes exceeds %d", len(out.Body), maxEndRequestBody))
+			out.Body = nil
+		}
+		if out.DelayMillis < 0 || out.DelayMillis > maxResponseDelay.Milliseconds() {
+			errs = append(errs, fmt.Errorf("invalid response delay %dms", out.DelayMillis))
+			out.DelayMillis = 0
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown response type %d", out.Type))
+		dropResponseType(out)
+	}
+	return errors.Join(errs...)
+}
+
+// validateReportOut returns an error if the request ID, request headers or
+// response actions of a response are invalid, removing them
+func validateReportOut(out *RPCMsgOut) error {
+	var errs []error
+	if !validHeaderValue(out.RequestID) {
+		errs = append(errs, fmt.Errorf("invalid RequestID %q", out.RequestID))
+		out.RequestID = ""
+	}
+	var err error
+	out.RequestHeaders, err = removeInvalid("request header", out.RequestHeaders, validateRequestHeader)
+	errs = append(errs, err)
+	out.RespActions, err = removeInvalid("response action", out.RespActions, validateHeaderAction)
+	errs = append(errs, err)
+	return errors.Join(errs...)
+}
+
+// removeInvalid returns the entries that are valid according to check,
+// with an error for each entry removed. The entries are copied if any are
+// removed, as they may be shared with the inspector.
+func removeInvalid[T any](what string, entries []T, check func(T) error) ([]T, error) {
+	var valid []T
+	var errs []error
+	for i, e := range entries {
+		if err := check(e); err != nil {
+			if valid == nil {
+				valid = append(make([]T, 0, len(entries)-1), entries[:i]...)
+			}
+			errs = append(errs, fmt.Errorf("%s %d: %w", what, i, err))
+		} else if valid != nil {
+			valid = append(valid, e)
+		}
+	}
+	if valid == nil {
+		return entries, nil
+	}
+	return valid, errors.Join(errs...)
+}
+
+// validateRequestHeader returns an error if the request header from the
+// agent has an invalid name or value, or is an invalid redirect
+func validateRequestHeader(kv [2]string) error {
+	if err := validateHeader(kv[0], kv[1]); err != nil {
+		return err
+	}
+	if http.CanonicalHeaderKey(kv[0]) == "X-Sigsci-Redirect" {
+		if u, err := url.Parse(kv[1]); err != nil || kv[1] == "" || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid redirect %q", kv[1])
+		}
+	}
+	return nil
+}
+
+// validateHeaderAction returns an error if the header action is malformed
+// or has an invalid header name or value
+func validateHeaderAction(a schema.Action) error {
+	if err := checkHeaderAction(a); err != nil {
+		return err
+	}
+	if a.Code == schema.DelHdr {
+		return validateHeader(a.Args[0], "")
+	}
+	return validateHeader(a.Args[0], a.Args[1])
+}
+
+// validateRequestAction returns an error if the request action is malformed
+// or would set an invalid header or path
+func validateRequestAction(a schema.Action) error {
+	if err := checkRequestAction(a); err != nil {
+		return err
+	}
+	switch a.Code {
+	case schema.AddHdr, schema.SetHdr, schema.SetNEHdr:
+		return validateHeader(a.Args[0], a.Args[1])
+	case schema.DelHdr:
+		return validateHeader(a.Args[0], "")
+	case schema.RewritePath:
+		if !validHeaderValue(a.Args[0]) {
+			return fmt.Errorf("invalid path %q", a.Args[0])
+		}
+	}
+	return nil
+}
+
+// validateHeader returns an error if the header name or value is invalid
+func validateHeader(name, value string) error {
+	if !validHeaderName(name) {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if !validHeaderValue(value) {
+		return fmt.Errorf("invalid header value %q for %s", value, name)
+	}
+	return nil
+}
+
+// validHeaderName returns true if the name is a token (RFC 7230 3.2.6)
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isTokenChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar returns true for a tchar (RFC 7230 3.2.6)
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	switch c {
+	case '!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~':
+		return true
+	}
+	return false
+}
+
+// validHeaderValue returns true if the value is a field-value, i.e., has
+// no control characters other than horizontal tabs (RFC 7230 3.2)
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package sigsci
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/signalsciences/sigsci-module-golang/schema"
+)
+
+func TestValidatePreRequestOut(t *testing.T) {
+	m, err := NewModule(http.NotFoundHandler(), CustomInspector(newTestInspector(200, ""), nil, nil))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	cases := []struct {
+		out   RPCMsgOut
+		valid bool
+	}{
+		{RPCMsgOut{WAFResponse: 200}, true},
+		{RPCMsgOut{WAFResponse: 406, RequestID: "0123456789abcdef01234567", RequestHeaders: [][2]string{{"X-Sigsci-Tags", "XSS, SQLI"}}}, true},
+		{RPCMsgOut{WAFResponse: 302, RequestHeaders: [][2]string{{"X-Sigsci-Redirect", "https://example.com/blocked"}}}, true},
+		{RPCMsgOut{WAFResponse: 200, RespActions: []schema.Action{{Code: schema.DelHdr, Args: []string{"Server"}}}}, true},
+		{RPCMsgOut{WAFResponse: 406, RespActions: []schema.Action{{Code: schema.DelHdr, Args: []string{"Server", ""}}}}, true},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.EndRequest, StatusCode: 503, Body: []byte("maintenance")}, true},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.Tarpit, StatusCode: 429, DelayMillis: 5000}, true},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.DropConnection, StatusCode: 403}, true},
+		{RPCMsgOut{WAFResponse: 200, ReqActions: []schema.Action{{Code: schema.RewritePath, Args: []string{"/"}}, {Code: schema.StripBody}}}, true},
+		{RPCMsgOut{WAFResponse: 200, ReqActions: []schema.Action{{Code: schema.DelQueryParam, Args: []string{"q", ""}}}}, true},
+		// The WAFResponse is checked when it is used
+		{RPCMsgOut{}, true},
+		{RPCMsgOut{WAFResponse: 600}, true},
+		{RPCMsgOut{Type: schema.EndRequest, StatusCode: 403}, true},
+		{RPCMsgOut{WAFResponse: 200, RequestID: "id\r\nX-Injected: 1"}, false},
+		{RPCMsgOut{WAFResponse: 200, RequestHeaders: [][2]string{{"X Tags", "XSS"}}}, false},
+		{RPCMsgOut{WAFResponse: 200, RequestHeaders: [][2]string{{"X-Sigsci-Tags", "XSS\n"}}}, false},
+		{RPCMsgOut{WAFResponse: 302, RequestHeaders: [][2]string{{"X-Sigsci-Redirect", "javascript:alert(1)"}}}, false},
+		{RPCMsgOut{WAFResponse: 302, RequestHeaders: [][2]string{{"X-Sigsci-Redirect", ""}}}, false},
+		{RPCMsgOut{WAFResponse: 200, RespActions: []schema.Action{{Code: schema.AddHdr, Args: []string{"X-Resp"}}}}, false},
+		{RPCMsgOut{WAFResponse: 200, RespActions: []schema.Action{{Code: schema.SetHdr, Args: []string{"", "1"}}}}, false},
+		{RPCMsgOut{WAFResponse: 200, RespActions: []schema.Action{{Code: 9, Args: []string{"X-Resp"}}}}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: 9}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.EndRequest}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.EndRequest, StatusCode: 1000}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.EndRequest, StatusCode: 403, Header: []schema.Action{{Code: schema.SetHdr, Args: []string{"Content-Type"}}}}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.EndRequest, StatusCode: 403, Body: make([]byte, maxEndRequestBody+1)}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.SlowResponse, StatusCode: 429, DelayMillis: -1}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.Tarpit, StatusCode: 429, DelayMillis: maxResponseDelay.Milliseconds() + 1}, false},
+		{RPCMsgOut{WAFResponse: 200, Type: schema.DropConnection}, false},
+		{RPCMsgOut{WAFResponse: 200, ReqActions: []schema.Action{{Code: schema.RewritePath, Args: []string{"/\r\n"}}}}, false},
+		{RPCMsgOut{WAFResponse: 200, ReqActions: []schema.Action{{Code: schema.SetHdr, Args: []string{"X-A", "\x00"}}}}, false},
+		{RPCMsgOut{WAFResponse: 200, ReqActions: []schema.Action{{Code: schema.SetQueryParam, Args: []string{"q"}}}}, false},
+	}
+	for pos, tt := range cases {
+		err := m.validatePreRequestOut(&tt.out)
+		if (err == nil) != tt.valid {
+			t.Errorf("test %d: unexpected result %v, expected valid=%t", pos, err, tt.valid)
+		}
+	}
+}
+
+// invalidInspector blocks requests with an invalid request header
+type invalidInspector struct {
+	testInspector
+}
+
+func (insp *invalidInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 406
+	out.RequestHeaders = [][2]string{{"X-Sigsci-Tags", "XSS\r\nX-Injected: 1"}, {"X-Sigsci-Agent", "1"}}
+	return nil
+}
+
+func TestValidateRemovesInvalid(t *testing.T) {
+	m, err := NewModule(http.NotFoundHandler(), CustomInspector(newTestInspector(200, ""), nil, nil))
+	if err != nil {
+		t.Fatalf("Failed to create module: %s", err)
+	}
+	defer m.Close()
+
+	headers := [][2]string{{"X Tags", "XSS"}, {"X-Sigsci-Tags", "SQLI"}, {"X-Sigsci-Redirect", "javascript:alert(1)"}}
+	out := RPCMsgOut{
+		WAFResponse:    406,
+		RequestID:      "id\n",
+		RequestHeaders: headers,
+		RespActions:    []schema.Action{{Code: schema.SetHdr, Args: []string{"X-A"}}, {Code: schema.DelHdr, Args: []string{"Server"}}},
+		ReqActions:     []schema.Action{{Code: schema.RewritePath, Args: []string{"relative"}}},
+		Type:           schema.EndRequest,
+		StatusCode:     403,
+		DelayMillis:    -1,
+	}
+	if err := m.validatePreRequestOut(&out); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	expected := RPCMsgOut{
+		WAFResponse:    406,
+		RequestHeaders: [][2]string{{"X-Sigsci-Tags", "SQLI"}},
+		RespActions:    []schema.Action{{Code: schema.DelHdr, Args: []string{"Server"}}},
+		ReqActions:     []schema.Action{},
+		Type:           schema.EndRequest,
+		StatusCode:     403,
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Unexpected response after validation %+v, expected %+v", out, expected)
+	}
+	if headers[0][0] != "X Tags" {
+		t.Errorf("Unexpected change to the inspector's request headers %q", headers)
+	}
+
+	// An invalid response type is removed as a whole
+	out = RPCMsgOut{WAFResponse: 406, Type: schema.EndRequest, StatusCode: 1000, Body: []byte("x")}
+	m.validatePreRequestOut(&out)
+	if !reflect.DeepEqual(out, RPCMsgOut{WAFResponse: 406}) {
+		t.Errorf("Unexpected response after validation %+v", out)
+	}
+}
+
+func TestStrictProtocol(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		m, err := NewModule(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }),
+			CustomInspector(&invalidInspector{}, nil, nil),
+			StrictProtocol(strict),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create module: %s", err)
+		}
+
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		switch {
+		case strict && (w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "invalid RPC.PreRequest response")):
+			t.Errorf("strict: unexpected response %d %q", w.Code, w.Body.String())
+		case !strict && w.Code != 406:
+			// Only the malformed request header is ignored
+			t.Errorf("Expected the request to be blocked, got %d %q", w.Code, w.Body.String())
+		}
+		m.Close()
+	}
+}
+
+// invalidReportInspector replies to reports with an invalid request header
+type invalidReportInspector struct {
+	capsInspector
+}
+
+func (insp *invalidReportInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 200
+	out.RequestHeaders = [][2]string{{"X-Sigsci-Tags", "\x00"}}
+	return nil
+}
+
+func TestStrictProtocolReports(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		insp := &invalidReportInspector{capsInspector{version: schema.ProtocolVersion, caps: []string{schema.CapReportResponse}}}
+		called := false
+		m, err := NewModule(
+			http.NotFoundHandler(),
+			CustomInspector(insp, nil, nil),
+			ReportResponseHandler(func(in *RPCMsgIn, in2 *RPCMsgIn2, out *RPCMsgOut) { called = true }),
+			StrictProtocol(strict),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create module: %s", err)
+		}
+
+		err = m.inspectorPostRequest(&RPCMsgIn{URI: "/"})
+		var perr *ProtocolError
+		if errors.As(err, &perr) != strict || called {
+			t.Errorf("strict=%t: unexpected report result %v (handler called: %t)", strict, err, called)
+		}
+		m.Close()
+	}
+}
+
+// invalidCodeInspector replies to PreRequest with an invalid WAFResponse,
+// or ends the request without setting one, recording the PostRequest URIs
+type invalidCodeInspector struct {
+	testInspector
+	mu    sync.Mutex
+	posts []string
+}
+
+func (insp *invalidCodeInspector) PostRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	insp.mu.Lock()
+	insp.posts = append(insp.posts, in.URI)
+	insp.mu.Unlock()
+	out.WAFResponse = 200
+	return nil
+}
+
+func (insp *invalidCodeInspector) PostRequests() []string {
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	return insp.posts
+}
+
+func (insp *invalidCodeInspector) PreRequest(in *RPCMsgIn, out *RPCMsgOut) error {
+	out.WAFResponse = 0
+	if in.URI == "/end" {
+		out.Type = schema.EndRequest
+		out.StatusCode = 403
+		out.Body = []byte("blocked")
+	}
+	return nil
+}
+
+func TestInvalidWAFResponse(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		insp := &invalidCodeInspector{}
+		m, err := NewModule(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(503)
+				w.Write([]byte("ok"))
+			}),
+			CustomInspector(insp, nil, nil),
+			StrictProtocol(strict),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create module: %s", err)
+		}
+
+		// An EndRequest response does not need a WAFResponse
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/end", nil))
+		if w.Code != 403 || w.Body.String() != "blocked" {
+			t.Errorf("strict=%t: unexpected EndRequest response %d %q", strict, w.Code, w.Body.String())
+		}
+
+		// Otherwise an invalid code fails open (or fails in strict mode),
+		// with the request still reported
+		w = httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		switch {
+		case strict && w.Code != http.StatusBadGateway:
+			t.Errorf("strict: unexpected response %d %q", w.Code, w.Body.String())
+		case !strict && (w.Code != 503 || w.Body.String() != "ok"):
+			t.Errorf("Expected to fail open, got %d %q", w.Code, w.Body.String())
+		}
+		if err := m.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Failed to shut down module: %s", err)
+		}
+		if posts := insp.PostRequests(); len(posts) != 1 || posts[0] != "/" {
+			t.Errorf("strict=%t: unexpected PostRequest reports %q", strict, posts)
+		}
+	}
+}